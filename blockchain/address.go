@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+)
+
+func PublicToAddress(pubData string) string {
+	if pub := ParsePublic(pubData); pub != nil {
+		pubData = StringPublic(pub)
+	} else if ms := ParseMultisig(pubData); ms != nil {
+		pubData = ms.String()
+	} else {
+		return ""
+	}
+	payload := append([]byte{ADDRESS_VERSION}, HashSum([]byte(pubData))[:ADDRESS_SIZE]...)
+	return Base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+func AddressIsValid(address string) bool {
+	data := Base58Decode(address)
+	if len(data) != 1+ADDRESS_SIZE+CHECKSUM_SIZE || data[0] != ADDRESS_VERSION {
+		return false
+	}
+	payload := data[:len(data)-CHECKSUM_SIZE]
+	return bytes.Equal(addressChecksum(payload), data[len(data)-CHECKSUM_SIZE:])
+}
+
+func addressChecksum(payload []byte) []byte {
+	return HashSum(HashSum(payload))[:CHECKSUM_SIZE]
+}
+
+func Base58Encode(data []byte) string {
+	var (
+		result []byte
+		num    = new(big.Int).SetBytes(data)
+		base   = big.NewInt(58)
+		mod    = new(big.Int)
+	)
+	for num.Sign() > 0 {
+		num.DivMod(num, base, mod)
+		result = append(result, BASE58_ALPHABET[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		result = append(result, BASE58_ALPHABET[0])
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return string(result)
+}
+
+func Base58Decode(data string) []byte {
+	var (
+		num   = big.NewInt(0)
+		base  = big.NewInt(58)
+		zeros = 0
+	)
+	for zeros < len(data) && data[zeros] == BASE58_ALPHABET[0] {
+		zeros++
+	}
+	for _, c := range data {
+		index := strings.IndexRune(BASE58_ALPHABET, c)
+		if index < 0 {
+			return nil
+		}
+		num.Mul(num, base)
+		num.Add(num, big.NewInt(int64(index)))
+	}
+	return append(make([]byte, zeros), num.Bytes()...)
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		data    string
+		encoded string
+	}{
+		{"", ""},
+		{"61", "2g"},
+		{"626262", "a3gV"},
+		{"636363", "aPEr"},
+		{"516b6fcd0f", "ABnLTmg"},
+		{"572e4794", "3EFU7m"},
+		{"10c8511e", "Rt5zm"},
+		{"00000000000000000000", "1111111111"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	}
+	for _, test := range tests {
+		t.Run(test.encoded, func(t *testing.T) {
+			data, err := hex.DecodeString(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoded := Base58Encode(data); encoded != test.encoded {
+				t.Fatalf("Base58Encode = %s, want %s", encoded, test.encoded)
+			}
+			if decoded := Base58Decode(test.encoded); !bytes.Equal(decoded, data) {
+				t.Fatalf("Base58Decode = %x, want %x", decoded, data)
+			}
+		})
+	}
+	if Base58Decode("10") != nil {
+		t.Fatal("invalid character decoded")
+	}
+}
+
+func TestAddressIsValid(t *testing.T) {
+	user := NewUserScheme(SCHEME_ED25519)
+	address := user.Address()
+	flip := []byte(address)
+	if flip[len(flip)-1] == 'a' {
+		flip[len(flip)-1] = 'b'
+	} else {
+		flip[len(flip)-1] = 'a'
+	}
+	payload := append([]byte{ADDRESS_VERSION + 1}, make([]byte, ADDRESS_SIZE)...)
+	tests := []struct {
+		name    string
+		address string
+		valid   bool
+	}{
+		{"user", address, true},
+		{"public key", PublicToAddress(user.PublicKey()), true},
+		{"empty", "", false},
+		{"checksum", string(flip), false},
+		{"short", address[:len(address)-1], false},
+		{"invalid character", "0" + address[1:], false},
+		{"version", Base58Encode(append(payload, addressChecksum(payload)...)), false},
+		{"public", user.PublicKey(), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := AddressIsValid(test.address); valid != test.valid {
+				t.Fatalf("AddressIsValid(%q) = %v, want %v", test.address, valid, test.valid)
+			}
+		})
+	}
+	if address != PublicToAddress(user.PublicKey()) || PublicToAddress("public") != "" {
+		t.Fatal("address is not bound to public key")
+	}
+}
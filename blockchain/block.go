@@ -1,17 +1,17 @@
 package blockchain
 
 import (
-	"time"
-	"errors"
 	"bytes"
-	"crypto/rsa"
+	"crypto"
+	"errors"
 	"math/big"
 	"sort"
+	"time"
 )
 
-func NewBlock(miner string, prevHash []byte) *Block {
+func NewBlock(miner string, prevHash []byte, difficulty uint8) *Block {
 	return &Block{
-		Difficulty: DIFFICULTY,
+		Difficulty: difficulty,
 		PrevHash:   prevHash,
 		Miner:      miner,
 		Mapping:    make(map[string]uint64),
@@ -19,17 +19,24 @@ func NewBlock(miner string, prevHash []byte) *Block {
 }
 
 func (block *Block) Accept(chain *BlockChain, user *User, ch chan bool) error {
-	if !block.transactionsIsValid(chain, chain.Size()) {
+	block.sortByFee()
+	block.Version = chain.Version(chain.Size() + 1)
+	block.TimeStamp = time.Now().Format(time.RFC3339)
+	if len(block.Transactions) != 0 && !block.transactionsIsValid(chain, chain.Size()) {
 		return errors.New("transactions is not valid")
 	}
-	block.AddTransaction(chain, &Transaction{
-		RandBytes: GenerateRandomBytes(RAND_BYTES),
-		PrevBlock: chain.LastHash(),
-		Sender:    STORAGE_CHAIN,
-		Receiver:  user.Address(),
-		Value:     STORAGE_REWARD,
-	})
-	block.TimeStamp = time.Now().Format(time.RFC3339)
+	if subsidy := Subsidy(chain.Size()); subsidy != 0 {
+		tx := &Transaction{
+			Version:   block.Version,
+			RandBytes: GenerateRandomBytes(RAND_BYTES),
+			Sender:    STORAGE_CHAIN,
+			Outputs:   []Output{{Receiver: user.Address(), Value: subsidy}},
+		}
+		tx.CurrHash = tx.hash(chain.genesis)
+		block.AddTransaction(chain, tx)
+	}
+	block.MerkleRoot = block.merkleRoot()
+	block.PublicKey = user.PublicKey()
 	block.CurrHash = block.hash()
 	block.Signature = block.sign(user.Private())
 	block.Nonce = block.proof(ch)
@@ -40,20 +47,65 @@ func (block *Block) AddTransaction(chain *BlockChain, tx *Transaction) error {
 	if tx == nil {
 		return errors.New("tx is null")
 	}
-	if tx.Value == 0 {
-		return errors.New("tx value = 0")
+	if !tx.IsFinal(chain.Size()+1, time.Now()) {
+		return errors.New("tx is locked")
+	}
+	if block.size == 0 {
+		block.size = block.Size()
+	}
+	size := block.size + tx.size()
+	if tx.Sender != STORAGE_CHAIN && size > BLOCK_SIZE-BLOCK_RESERVE {
+		return errors.New("block size > limit")
+	}
+	err := block.appendTransaction(chain, tx)
+	if err != nil {
+		return err
+	}
+	block.size = size
+	return nil
+}
+
+func (block *Block) Size() int {
+	return len(EncodeBlock(block))
+}
+
+func (block *Block) appendTransaction(chain *BlockChain, tx *Transaction) error {
+	if tx == nil {
+		return errors.New("tx is null")
+	}
+	if !chain.txVersionIsValid(tx.Version, chain.Size()+1) {
+		return errors.New("tx version is not valid")
+	}
+	if len(tx.Outputs) == 0 || len(tx.Outputs) > OUTPUTS_LIMIT {
+		return errors.New("len outputs = 0 or > limit")
+	}
+	for _, out := range tx.Outputs {
+		if out.Value == 0 {
+			return errors.New("tx value = 0")
+		}
 	}
-	if tx.Sender != STORAGE_CHAIN && len(block.Transactions) == TXS_LIMIT {
-		return errors.New("len tx = limit")
+	total, ok := tx.Total()
+	if !ok {
+		return errors.New("tx value overflow")
 	}
-	if tx.Sender != STORAGE_CHAIN && tx.Value > START_PERCENT && tx.ToStorage != STORAGE_REWARD {
-		return errors.New("storage reward pass")
+	if tx.Sender == STORAGE_CHAIN && tx.Fee != 0 {
+		return errors.New("storage fee /= 0")
 	}
-	if !bytes.Equal(tx.PrevBlock, chain.LastHash()) {
-		return errors.New("prev block in tx /= last hash in chain")
+	if tx.Sender != STORAGE_CHAIN && tx.Nonce != chain.Nonce(tx.Sender, chain.Size())+block.nonce(tx.Sender, len(block.Transactions)) {
+		return errors.New("nonce in tx /= nonce of sender")
+	}
+	if tx.Sender == STORAGE_CHAIN {
+		for _, out := range tx.Outputs {
+			block.addBalance(chain, out.Receiver, out.Value)
+		}
+		block.Transactions = append(block.Transactions, *tx)
+		return nil
 	}
 	var balanceInChain uint64
-	balanceInTX := tx.Value + tx.ToStorage
+	balanceInTX := total + tx.Fee
+	if balanceInTX < total {
+		return errors.New("tx value overflow")
+	}
 	if value, ok := block.Mapping[tx.Sender]; ok {
 		balanceInChain = value
 	} else {
@@ -63,8 +115,10 @@ func (block *Block) AddTransaction(chain *BlockChain, tx *Transaction) error {
 		return errors.New("insufficient funds")
 	}
 	block.Mapping[tx.Sender] = balanceInChain - balanceInTX
-	block.addBalance(chain, tx.Receiver, tx.Value)
-	block.addBalance(chain, STORAGE_CHAIN, tx.ToStorage)
+	for _, out := range tx.Outputs {
+		block.addBalance(chain, out.Receiver, out.Value)
+	}
+	block.addBalance(chain, block.Miner, tx.Fee)
 	block.Transactions = append(block.Transactions, *tx)
 	return nil
 }
@@ -73,13 +127,17 @@ func (block *Block) IsValid(chain *BlockChain, size uint64) bool {
 	switch {
 	case block == nil:
 		return false
-	case block.Difficulty != DIFFICULTY:
+	case block.Version != chain.Version(size+1):
+		return false
+	case block.Difficulty != chain.Difficulty(size):
 		return false
 	case !block.hashIsValid(chain, size):
 		return false
 	case !block.signIsValid():
 		return false
-	case !block.proofIsValid():
+	case !block.proofIsValid(chain.Difficulty(size)):
+		return false
+	case !block.merkleIsValid():
 		return false
 	case !block.mappingIsValid():
 		return false
@@ -91,6 +149,10 @@ func (block *Block) IsValid(chain *BlockChain, size uint64) bool {
 	return true
 }
 
+func (block *Block) Work() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(block.Difficulty))
+}
+
 func (block *Block) addBalance(chain *BlockChain, receiver string, value uint64) {
 	var balanceInChain uint64
 	if v, ok := block.Mapping[receiver]; ok {
@@ -101,6 +163,39 @@ func (block *Block) addBalance(chain *BlockChain, receiver string, value uint64)
 	block.Mapping[receiver] = balanceInChain + value
 }
 
+func (block *Block) sortByFee() {
+	var senders = make(map[string][]Transaction)
+	for _, tx := range block.Transactions {
+		senders[tx.Sender] = append(senders[tx.Sender], tx)
+	}
+	sort.SliceStable(block.Transactions, func(i, j int) bool {
+		return block.Transactions[i].Fee > block.Transactions[j].Fee
+	})
+	for i, tx := range block.Transactions {
+		block.Transactions[i] = senders[tx.Sender][0]
+		senders[tx.Sender] = senders[tx.Sender][1:]
+	}
+}
+
+func (block *Block) copy() *Block {
+	temp := NewBlock(block.Miner, block.PrevHash, block.Difficulty)
+	temp.Transactions = append(temp.Transactions, block.Transactions...)
+	for address, balance := range block.Mapping {
+		temp.Mapping[address] = balance
+	}
+	return temp
+}
+
+func (block *Block) nonce(address string, index int) uint64 {
+	var nonce uint64
+	for i := 0; i < index; i++ {
+		if block.Transactions[i].Sender == address {
+			nonce++
+		}
+	}
+	return nonce
+}
+
 func (block *Block) timeIsValid(chain *BlockChain) bool {
 	btime, err := time.Parse(time.RFC3339, block.TimeStamp)
 	if err != nil {
@@ -112,12 +207,7 @@ func (block *Block) timeIsValid(chain *BlockChain) bool {
 		return false
 	}
 
-	var sblock string
-	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Hash=$1", 
-		Base64Encode(block.PrevHash))
-	row.Scan(&sblock)
-
-	lblock := DeserializeBlock(sblock)
+	lblock := chain.Block(chain.Store.Height(block.PrevHash))
 	if lblock == nil {
 		return false
 	}
@@ -133,48 +223,77 @@ func (block *Block) timeIsValid(chain *BlockChain) bool {
 
 func (block *Block) transactionsIsValid(chain *BlockChain, size uint64) bool {
 	lentxs := len(block.Transactions)
-	plusStorage := 0
+	if (lentxs == 0 && Subsidy(size) != 0) || block.Size() > BLOCK_SIZE {
+		return false
+	}
+	btime, err := time.Parse(time.RFC3339, block.TimeStamp)
+	if err != nil {
+		return false
+	}
+	var (
+		randBytes = make(map[string]bool)
+		storages  = 0
+	)
 	for i := 0; i < lentxs; i++ {
+		rand := string(block.Transactions[i].RandBytes)
+		if randBytes[rand] {
+			return false
+		}
+		randBytes[rand] = true
 		if block.Transactions[i].Sender == STORAGE_CHAIN {
-			plusStorage = 1
-			break
+			storages++
 		}
 	}
-	if lentxs == 0 || lentxs > TXS_LIMIT+plusStorage {
+	if storages > 1 {
 		return false
 	}
-	for i := 0; i < lentxs-1; i++ {
-		for j := i + 1; j < lentxs; j++ {
-			if bytes.Equal(block.Transactions[i].RandBytes, block.Transactions[j].RandBytes) {
+	for i := 0; i < lentxs; i++ {
+		tx := block.Transactions[i]
+		if !chain.txVersionIsValid(tx.Version, size+1) || !tx.hashIsValid(chain.genesis) {
+			return false
+		}
+		if tx.Sender != STORAGE_CHAIN && tx.Nonce != chain.Nonce(tx.Sender, size)+block.nonce(tx.Sender, i) {
+			return false
+		}
+		total, ok := tx.Total()
+		if !ok || len(tx.Outputs) == 0 || len(tx.Outputs) > OUTPUTS_LIMIT || total+tx.Fee < total {
+			return false
+		}
+		for _, out := range tx.Outputs {
+			if out.Value == 0 {
 				return false
 			}
-			if 	block.Transactions[i].Sender == STORAGE_CHAIN && 
-				block.Transactions[j].Sender == STORAGE_CHAIN {
-					return false
-			}
 		}
-	}
-	for i := 0; i < lentxs; i++ {
-		tx := block.Transactions[i]
+		if !tx.IsFinal(size+1, btime) {
+			return false
+		}
 		if tx.Sender == STORAGE_CHAIN {
-			if tx.Receiver != block.Miner || tx.Value != STORAGE_REWARD {
+			if len(tx.Outputs) != 1 || tx.Outputs[0].Receiver != block.Miner ||
+				tx.Outputs[0].Value != Subsidy(size) || tx.Fee != 0 {
 				return false
 			}
 		} else {
-			if !tx.hashIsValid() {
-				return false
+			for _, out := range tx.Outputs {
+				if !AddressIsValid(out.Receiver) {
+					return false
+				}
 			}
 			if !tx.signIsValid() {
 				return false
 			}
+			if !block.balanceIsValid(chain, tx.Sender, size) {
+				return false
+			}
 		}
-		if !block.balanceIsValid(chain, tx.Sender, size) {
-			return false
-		}
-		if !block.balanceIsValid(chain, tx.Receiver, size) {
-			return false
+		for _, out := range tx.Outputs {
+			if !block.balanceIsValid(chain, out.Receiver, size) {
+				return false
+			}
 		}
 	}
+	if _, ok := block.Mapping[block.Miner]; ok && !block.balanceIsValid(chain, block.Miner, size) {
+		return false
+	}
 	return true
 }
 
@@ -189,108 +308,136 @@ func (block *Block) balanceIsValid(chain *BlockChain, address string, size uint6
 	for j := 0; j < lentxs; j++ {
 		tx := block.Transactions[j]
 		if tx.Sender == address {
-			balanceSubBlock += tx.Value + tx.ToStorage
+			total, ok := tx.Total()
+			if !ok || total+tx.Fee < total || balanceSubBlock+total+tx.Fee < balanceSubBlock {
+				return false
+			}
+			balanceSubBlock += total + tx.Fee
 		}
-		if tx.Receiver == address {
-			balanceAddBlock += tx.Value
+		for _, out := range tx.Outputs {
+			if out.Receiver == address {
+				if balanceAddBlock+out.Value < balanceAddBlock {
+					return false
+				}
+				balanceAddBlock += out.Value
+			}
 		}
-		if STORAGE_CHAIN == address {
-			balanceAddBlock += tx.ToStorage
+		if block.Miner == address {
+			if balanceAddBlock+tx.Fee < balanceAddBlock {
+				return false
+			}
+			balanceAddBlock += tx.Fee
 		}
 	}
-	if (balanceInChain + balanceAddBlock - balanceSubBlock) != block.Mapping[address] {
+	balance := balanceInChain + balanceAddBlock
+	if balance < balanceInChain || balance < balanceSubBlock {
 		return false
 	}
-	return true
+	return balance-balanceSubBlock == block.Mapping[address]
 }
 
-func (block *Block) hash() []byte {
-	var tempHash []byte
+func (block *Block) MerkleProof(index uint64) *Proof {
+	if index >= uint64(len(block.Transactions)) {
+		return nil
+	}
+	return &Proof{
+		Version:    block.Version,
+		Index:      index,
+		TxHash:     block.Transactions[index].CurrHash,
+		MerkleRoot: block.MerkleRoot,
+		Path:       MerklePath(block.Version, block.txHashes(), index),
+	}
+}
+
+func (block *Block) merkleRoot() []byte {
+	return MerkleRoot(block.Version, block.txHashes())
+}
+
+func (block *Block) txHashes() [][]byte {
+	var hashes [][]byte
 	for _, tx := range block.Transactions {
-		tempHash = HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				tx.CurrHash,
-			},
-			[]byte{},
-		))
+		hashes = append(hashes, tx.CurrHash)
 	}
+	return hashes
+}
+
+func (block *Block) hash() []byte {
+	return block.Header().hash()
+}
+
+func (block *Block) mappingRoot() []byte {
 	var list []string
-	for hash := range block.Mapping {
-		list = append(list, hash)
+	for address := range block.Mapping {
+		list = append(list, address)
 	}
 	sort.Strings(list)
-	for _, hash := range list {
-		tempHash = HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				[]byte(hash),
-				ToBytes(block.Mapping[hash]),
-			},
-			[]byte{},
-		))
-	}
-	return HashSum(bytes.Join(
-		[][]byte{
-			tempHash,
-			ToBytes(uint64(block.Difficulty)),
-			block.PrevHash,
-			[]byte(block.Miner),
-			[]byte(block.TimeStamp),
-		},
-		[]byte{},
-	))
+	if block.Version == LEGACY_VERSION {
+		tempHash := block.MerkleRoot
+		for _, address := range list {
+			tempHash = HashSum(bytes.Join(
+				[][]byte{
+					tempHash,
+					[]byte(address),
+					ToBytes(block.Mapping[address]),
+				},
+				[]byte{},
+			))
+		}
+		return tempHash
+	}
+	fields := [][]byte{
+		ToBytes(uint64(len(list))),
+	}
+	for _, address := range list {
+		fields = append(fields, []byte(address), ToBytes(block.Mapping[address]))
+	}
+	return CanonicalHash(TAG_MAPPING, fields...)
 }
 
-func (block *Block) sign(priv *rsa.PrivateKey) []byte {
+func (block *Block) sign(priv crypto.PrivateKey) []byte {
 	return Sign(priv, block.CurrHash)
 }
 
 func (block *Block) proof(ch chan bool) uint64 {
-	return ProofOfWork(block.CurrHash, block.Difficulty, ch)
+	return ProofOfWork(block.Version, block.CurrHash, block.Difficulty, ch)
 }
 
 func (block *Block) hashIsValid(chain *BlockChain, size uint64) bool {
 	if !bytes.Equal(block.hash(), block.CurrHash) {
 		return false
 	}
-	var id uint64
-	row := chain.DB.QueryRow("SELECT Id FROM BlockChain WHERE Hash=$1", 
-		Base64Encode(block.PrevHash))
-	row.Scan(&id)
-	return id == size
+	return chain.Store.Height(block.PrevHash) == size
 }
 
 func (block *Block) signIsValid() bool {
-	return Verify(ParsePublic(block.Miner), block.CurrHash, block.Signature) == nil
+	if block.PublicKey == "" {
+		return Verify(ParsePublic(block.Miner), block.CurrHash, block.Signature) == nil
+	}
+	if PublicToAddress(block.PublicKey) != block.Miner {
+		return false
+	}
+	return Verify(ParsePublic(block.PublicKey), block.CurrHash, block.Signature) == nil
 }
 
-func (block *Block) proofIsValid() bool {
-	intHash := big.NewInt(1)
-	Target := big.NewInt(1)
-	hash := HashSum(bytes.Join(
-		[][]byte{
-			block.CurrHash,
-			ToBytes(block.Nonce),
-		},
-		[]byte{},
-	))
-	intHash.SetBytes(hash)
-	Target.Lsh(Target, 256-uint(block.Difficulty))
-	if intHash.Cmp(Target) == -1 {
-		return true
-	}
-	return false
+func (block *Block) proofIsValid(difficulty uint8) bool {
+	return workIsValid(block.Version, block.CurrHash, block.Nonce, difficulty)
+}
+
+func (block *Block) merkleIsValid() bool {
+	return bytes.Equal(block.MerkleRoot, block.merkleRoot())
 }
 
 func (block *Block) mappingIsValid() bool {
 	for hash := range block.Mapping {
 		if hash == STORAGE_CHAIN {
+			return false
+		}
+		if hash == block.Miner {
 			continue
 		}
 		flag := false
 		for _, tx := range block.Transactions {
-			if tx.Sender == hash || tx.Receiver == hash {
+			if tx.Sender == hash || tx.hasReceiver(hash) {
 				flag = true
 				break
 			}
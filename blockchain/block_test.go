@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+)
+
+func testChain(t *testing.T, receiver string) *BlockChain {
+	chain, err := NewChain(STORE_MEMORY, "", receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Store.Close() })
+	return chain
+}
+
+func TestBlockBalanceIsValid(t *testing.T) {
+	chain := testChain(t, "alice")
+	spend := func(fee uint64, values ...uint64) Transaction {
+		tx := Transaction{Sender: "alice", Fee: fee}
+		for _, value := range values {
+			tx.Outputs = append(tx.Outputs, Output{Receiver: "bob", Value: value})
+		}
+		return tx
+	}
+	tests := []struct {
+		name    string
+		txs     []Transaction
+		mapping map[string]uint64
+		valid   bool
+	}{
+		{
+			name:    "spend",
+			txs:     []Transaction{spend(1, 60, 9)},
+			mapping: map[string]uint64{"alice": 30, "bob": 69},
+			valid:   true,
+		},
+		{
+			name:    "spend all",
+			txs:     []Transaction{spend(0, GENESIS_REWARD)},
+			mapping: map[string]uint64{"alice": 0, "bob": GENESIS_REWARD},
+			valid:   true,
+		},
+		{
+			name:    "wrong mapping",
+			txs:     []Transaction{spend(1, 60)},
+			mapping: map[string]uint64{"alice": 40, "bob": 60},
+		},
+		{
+			name:    "underflow",
+			txs:     []Transaction{spend(0, GENESIS_REWARD+1)},
+			mapping: map[string]uint64{"alice": math.MaxUint64, "bob": GENESIS_REWARD + 1},
+		},
+		{
+			name:    "fee underflow",
+			txs:     []Transaction{spend(1, GENESIS_REWARD)},
+			mapping: map[string]uint64{"alice": math.MaxUint64, "bob": GENESIS_REWARD},
+		},
+		{
+			name:    "sum overflow",
+			txs:     []Transaction{spend(0, math.MaxUint64-10), spend(0, 20)},
+			mapping: map[string]uint64{"alice": GENESIS_REWARD + 9, "bob": 9},
+		},
+		{
+			name:    "outputs overflow",
+			txs:     []Transaction{spend(0, math.MaxUint64, 2)},
+			mapping: map[string]uint64{"alice": GENESIS_REWARD + 1, "bob": 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := NewBlock("miner", chain.LastHash(), DIFFICULTY)
+			block.Transactions = test.txs
+			block.Mapping = test.mapping
+			if valid := block.balanceIsValid(chain, "alice", chain.Size()); valid != test.valid {
+				t.Fatalf("balanceIsValid = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+}
+
+func TestBlockAddTransaction(t *testing.T) {
+	chain := testChain(t, "alice")
+	version := chain.Version(chain.Size() + 1)
+	send := func(nonce, fee uint64, outputs ...Output) *Transaction {
+		return &Transaction{Version: version, Nonce: nonce, Sender: "alice", Outputs: outputs, Fee: fee}
+	}
+	bob := func(value uint64) Output { return Output{Receiver: "bob", Value: value} }
+	carol := func(value uint64) Output { return Output{Receiver: "carol", Value: value} }
+	locked := send(0, 0, bob(1))
+	locked.Lock = chain.Size() + 2
+	unlocked := send(0, 0, bob(1))
+	unlocked.Lock = chain.Size() + 1
+	legacy := send(0, 0, bob(1))
+	legacy.Version = LEGACY_VERSION
+	tests := []struct {
+		name    string
+		txs     []*Transaction
+		mapping map[string]uint64
+	}{
+		{"single", []*Transaction{send(0, 1, bob(10))}, map[string]uint64{"alice": 89, "bob": 10, "miner": 1}},
+		{"outputs", []*Transaction{send(0, 5, bob(10), carol(20), bob(5))}, map[string]uint64{"alice": 60, "bob": 15, "carol": 20, "miner": 5}},
+		{"nonces", []*Transaction{send(0, 1, bob(10)), send(1, 2, carol(20))}, map[string]uint64{"alice": 67, "bob": 10, "carol": 20, "miner": 3}},
+		{"spend all", []*Transaction{send(0, 10, bob(GENESIS_REWARD-10))}, map[string]uint64{"alice": 0, "bob": GENESIS_REWARD - 10, "miner": 10}},
+		{"unlocked", []*Transaction{unlocked}, map[string]uint64{"alice": GENESIS_REWARD - 1, "bob": 1, "miner": 0}},
+		{"future nonce", []*Transaction{send(1, 0, bob(1))}, nil},
+		{"repeated nonce", []*Transaction{send(0, 0, bob(1)), send(0, 0, bob(1))}, nil},
+		{"insufficient funds", []*Transaction{send(0, 1, bob(GENESIS_REWARD))}, nil},
+		{"outputs funds", []*Transaction{send(0, 0, bob(60), carol(60))}, nil},
+		{"later funds", []*Transaction{send(0, 0, bob(60)), send(1, 0, carol(60))}, nil},
+		{"zero value", []*Transaction{send(0, 0, bob(1), carol(0))}, nil},
+		{"no outputs", []*Transaction{send(0, 0)}, nil},
+		{"outputs limit", []*Transaction{send(0, 0, make([]Output, OUTPUTS_LIMIT+1)...)}, nil},
+		{"outputs overflow", []*Transaction{send(0, 0, bob(math.MaxUint64), carol(2))}, nil},
+		{"fee overflow", []*Transaction{send(0, math.MaxUint64, bob(1))}, nil},
+		{"locked", []*Transaction{locked}, nil},
+		{"version", []*Transaction{legacy}, nil},
+		{"null", []*Transaction{nil}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := NewBlock("miner", chain.LastHash(), DIFFICULTY)
+			var err error
+			for _, tx := range test.txs {
+				if err = block.AddTransaction(chain, tx); err != nil {
+					break
+				}
+			}
+			if (err == nil) != (test.mapping != nil) {
+				t.Fatalf("AddTransaction = %v, want valid %v", err, test.mapping != nil)
+			}
+			for address, balance := range test.mapping {
+				if block.Mapping[address] != balance {
+					t.Fatalf("balance of %s = %d, want %d", address, block.Mapping[address], balance)
+				}
+			}
+			if err == nil && len(block.Mapping) != len(test.mapping) {
+				t.Fatalf("mapping = %v, want %v", block.Mapping, test.mapping)
+			}
+		})
+	}
+}
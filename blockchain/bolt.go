@@ -0,0 +1,510 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	bolt "go.etcd.io/bbolt"
+	"math/big"
+	"time"
+)
+
+func OpenBoltStore(filename string) (*BoltStore, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket([]byte(BUCKET_POOLHASH)) != nil
+		for _, name := range []string{
+			BUCKET_BLOCKS,
+			BUCKET_HEADERS,
+			BUCKET_HASHES,
+			BUCKET_WORK,
+			BUCKET_TXINDEX,
+			BUCKET_ADDRESS,
+			BUCKET_BALANCES,
+			BUCKET_MEMPOOL,
+			BUCKET_POOLHASH,
+		} {
+			_, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+		if indexed {
+			return nil
+		}
+		index := tx.Bucket([]byte(BUCKET_POOLHASH))
+		return tx.Bucket([]byte(BUCKET_MEMPOOL)).ForEach(func(key, value []byte) error {
+			ptx := DecodeTX(value)
+			if ptx == nil {
+				return nil
+			}
+			return index.Put(ptx.CurrHash, key)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{
+		DB: db,
+	}, nil
+}
+
+func (store *BoltStore) Size() uint64 {
+	var size uint64
+	store.view(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket([]byte(BUCKET_BLOCKS)).Cursor().Last()
+		size = fromBytes(key)
+		return nil
+	})
+	return size
+}
+
+func (store *BoltStore) Block(id uint64) *Block {
+	var block *Block
+	store.view(func(tx *bolt.Tx) error {
+		block = DecodeBlock(tx.Bucket([]byte(BUCKET_BLOCKS)).Get(ToBytes(id)))
+		return nil
+	})
+	return block
+}
+
+func (store *BoltStore) Hash(id uint64) []byte {
+	header := store.Header(id)
+	if header == nil {
+		return nil
+	}
+	return header.CurrHash
+}
+
+func (store *BoltStore) Header(id uint64) *BlockHeader {
+	var header *BlockHeader
+	store.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(BUCKET_HEADERS)).Get(ToBytes(id))
+		if data == nil {
+			header = headerOf(DecodeBlock(tx.Bucket([]byte(BUCKET_BLOCKS)).Get(ToBytes(id))))
+			return nil
+		}
+		header = DecodeHeader(data)
+		return nil
+	})
+	return header
+}
+
+func (store *BoltStore) Height(hash []byte) uint64 {
+	var id uint64
+	store.view(func(tx *bolt.Tx) error {
+		id = fromBytes(tx.Bucket([]byte(BUCKET_HASHES)).Get(hash))
+		return nil
+	})
+	return id
+}
+
+func (store *BoltStore) Work(id uint64) *big.Int {
+	work := big.NewInt(0)
+	store.view(func(tx *bolt.Tx) error {
+		work.SetBytes(tx.Bucket([]byte(BUCKET_WORK)).Get(ToBytes(id)))
+		return nil
+	})
+	return work
+}
+
+func (store *BoltStore) Append(id uint64, block *Block, work *big.Int) error {
+	return store.update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(BUCKET_BLOCKS))
+		key, _ := blocks.Cursor().Last()
+		if id != fromBytes(key)+1 {
+			return errors.New("block id is not valid")
+		}
+		hashes := tx.Bucket([]byte(BUCKET_HASHES))
+		if hashes.Get(block.CurrHash) != nil {
+			return errors.New("block already in store")
+		}
+		err := blocks.Put(ToBytes(id), EncodeBlock(block))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte(BUCKET_HEADERS)).Put(ToBytes(id), EncodeHeader(block.Header()))
+		if err != nil {
+			return err
+		}
+		err = hashes.Put(block.CurrHash, ToBytes(id))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BUCKET_WORK)).Put(ToBytes(id), work.Bytes())
+	})
+}
+
+func (store *BoltStore) Truncate(height uint64) error {
+	return store.update(func(tx *bolt.Tx) error {
+		var (
+			blocks  = tx.Bucket([]byte(BUCKET_BLOCKS))
+			headers = tx.Bucket([]byte(BUCKET_HEADERS))
+			hashes  = tx.Bucket([]byte(BUCKET_HASHES))
+			works   = tx.Bucket([]byte(BUCKET_WORK))
+			keys    [][]byte
+		)
+		cursor := blocks.Cursor()
+		for key, value := cursor.Seek(ToBytes(height + 1)); key != nil; key, value = cursor.Next() {
+			block := DecodeBlock(value)
+			if block != nil {
+				hashes.Delete(block.CurrHash)
+			}
+			keys = append(keys, append([]byte{}, key...))
+		}
+		for _, key := range keys {
+			blocks.Delete(key)
+			headers.Delete(key)
+			works.Delete(key)
+		}
+		err := deleteKeys(tx.Bucket([]byte(BUCKET_TXINDEX)), func(key, value []byte) bool {
+			return fromBytes(value[:8]) > height
+		})
+		if err != nil {
+			return err
+		}
+		err = deleteKeys(tx.Bucket([]byte(BUCKET_ADDRESS)), func(key, value []byte) bool {
+			sep := bytes.IndexByte(key, BUCKET_SEP[0])
+			return fromBytes(key[sep+1:sep+9]) > height
+		})
+		if err != nil {
+			return err
+		}
+		return deleteKeys(tx.Bucket([]byte(BUCKET_BALANCES)), func(key, value []byte) bool {
+			return fromBytes(key[len(key)-8:]) > height
+		})
+	})
+}
+
+func (store *BoltStore) ClearIndex() error {
+	return store.update(func(tx *bolt.Tx) error {
+		for _, name := range []string{
+			BUCKET_TXINDEX,
+			BUCKET_ADDRESS,
+			BUCKET_BALANCES,
+		} {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *BoltStore) AddTx(hash []byte, blockId, txId uint64) error {
+	return store.update(func(tx *bolt.Tx) error {
+		index := tx.Bucket([]byte(BUCKET_TXINDEX))
+		if index.Get(hash) != nil {
+			return errors.New("tx already in index")
+		}
+		return index.Put(hash, append(ToBytes(blockId), ToBytes(txId)...))
+	})
+}
+
+func (store *BoltStore) TxIndex(hash []byte) (uint64, uint64, bool) {
+	var (
+		blockId, txId uint64
+		found         = false
+	)
+	store.view(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(BUCKET_TXINDEX)).Get(hash)
+		if len(value) != 16 {
+			return nil
+		}
+		blockId, txId, found = fromBytes(value[:8]), fromBytes(value[8:]), true
+		return nil
+	})
+	return blockId, txId, found
+}
+
+func (store *BoltStore) AddHistory(address string, hash []byte, blockId uint64) error {
+	return store.update(func(tx *bolt.Tx) error {
+		key := append(append(addressKey(address), ToBytes(blockId)...), hash...)
+		return tx.Bucket([]byte(BUCKET_ADDRESS)).Put(key, hash)
+	})
+}
+
+func (store *BoltStore) History(address string, limit int) [][]byte {
+	var hashes [][]byte
+	store.view(func(tx *bolt.Tx) error {
+		prefix := addressKey(address)
+		cursor := tx.Bucket([]byte(BUCKET_ADDRESS)).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			hashes = append(hashes, append([]byte{}, value...))
+		}
+		return nil
+	})
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+	if len(hashes) > limit {
+		hashes = hashes[:limit]
+	}
+	return hashes
+}
+
+func (store *BoltStore) SetBalance(address string, blockId, balance, nonce uint64) error {
+	return store.update(func(tx *bolt.Tx) error {
+		key := append(addressKey(address), ToBytes(blockId)...)
+		return tx.Bucket([]byte(BUCKET_BALANCES)).Put(key, append(ToBytes(balance), ToBytes(nonce)...))
+	})
+}
+
+func (store *BoltStore) Balance(address string, size uint64) (uint64, uint64) {
+	var balance, nonce uint64
+	store.view(func(tx *bolt.Tx) error {
+		prefix := addressKey(address)
+		cursor := tx.Bucket([]byte(BUCKET_BALANCES)).Cursor()
+		key, value := cursor.Seek(append(prefix, ToBytes(size+1)...))
+		if key == nil {
+			key, value = cursor.Last()
+		} else {
+			key, value = cursor.Prev()
+		}
+		if !bytes.HasPrefix(key, prefix) || len(key) != len(prefix)+8 || len(value) != 16 {
+			return nil
+		}
+		balance, nonce = fromBytes(value[:8]), fromBytes(value[8:])
+		return nil
+	})
+	return balance, nonce
+}
+
+func (store *BoltStore) Supply(size uint64) uint64 {
+	var supply uint64
+	store.view(func(tx *bolt.Tx) error {
+		var (
+			address []byte
+			balance uint64
+		)
+		tx.Bucket([]byte(BUCKET_BALANCES)).ForEach(func(key, value []byte) error {
+			if len(key) < 9 || len(value) != 16 {
+				return nil
+			}
+			if !bytes.Equal(key[:len(key)-8], address) {
+				supply += balance
+				address = append([]byte{}, key[:len(key)-8]...)
+				balance = 0
+			}
+			if fromBytes(key[len(key)-8:]) <= size {
+				balance = fromBytes(value[:8])
+			}
+			return nil
+		})
+		supply += balance
+		return nil
+	})
+	return supply
+}
+
+func (store *BoltStore) PoolTransactions() []*Transaction {
+	var txs []*Transaction
+	store.view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BUCKET_MEMPOOL)).ForEach(func(key, value []byte) error {
+			ptx := DecodeTX(value)
+			if ptx != nil {
+				txs = append(txs, ptx)
+			}
+			return nil
+		})
+	})
+	return txs
+}
+
+func (store *BoltStore) PoolSize() uint64 {
+	var size uint64
+	store.view(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(BUCKET_POOLHASH)).Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			size++
+		}
+		return nil
+	})
+	return size
+}
+
+func (store *BoltStore) PoolContains(hash []byte) bool {
+	var found bool
+	store.view(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(BUCKET_POOLHASH)).Get(hash) != nil
+		return nil
+	})
+	return found
+}
+
+func (store *BoltStore) PoolAdd(ptx *Transaction) error {
+	return store.update(func(tx *bolt.Tx) error {
+		return poolPut(tx, ptx)
+	})
+}
+
+func (store *BoltStore) PoolReset(txs []*Transaction) error {
+	return store.update(func(tx *bolt.Tx) error {
+		for _, name := range []string{
+			BUCKET_MEMPOOL,
+			BUCKET_POOLHASH,
+		} {
+			err := tx.DeleteBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+		for _, ptx := range txs {
+			err := poolPut(tx, ptx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *BoltStore) Migrate() error {
+	return store.update(func(tx *bolt.Tx) error {
+		for name, convert := range map[string]func([]byte) ([]byte, error){
+			BUCKET_BLOCKS:  migrateBlock,
+			BUCKET_MEMPOOL: migrateTX,
+		} {
+			var (
+				bucket = tx.Bucket([]byte(name))
+				values = make(map[string][]byte)
+			)
+			err := bucket.ForEach(func(key, value []byte) error {
+				data, err := convert(value)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(data, value) {
+					values[string(key)] = data
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for key, data := range values {
+				err = bucket.Put([]byte(key), data)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		headers := tx.Bucket([]byte(BUCKET_HEADERS))
+		return tx.Bucket([]byte(BUCKET_BLOCKS)).ForEach(func(key, value []byte) error {
+			if headers.Get(key) != nil {
+				return nil
+			}
+			block := DecodeBlock(value)
+			if block == nil {
+				return errors.New("block is not valid")
+			}
+			return headers.Put(key, EncodeHeader(block.Header()))
+		})
+	})
+}
+
+func (store *BoltStore) Begin() (Store, error) {
+	if store.tx != nil {
+		return nil, errors.New("store in transaction")
+	}
+	tx, err := store.DB.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{
+		DB: store.DB,
+		tx: tx,
+	}, nil
+}
+
+func (store *BoltStore) Commit() error {
+	if store.tx == nil {
+		return errors.New("store not in transaction")
+	}
+	return store.tx.Commit()
+}
+
+func (store *BoltStore) Rollback() error {
+	if store.tx == nil {
+		return errors.New("store not in transaction")
+	}
+	return store.tx.Rollback()
+}
+
+func (store *BoltStore) Close() error {
+	return store.DB.Close()
+}
+
+func (store *BoltStore) view(fn func(*bolt.Tx) error) error {
+	if store.tx != nil {
+		return fn(store.tx)
+	}
+	return store.DB.View(fn)
+}
+
+func (store *BoltStore) update(fn func(*bolt.Tx) error) error {
+	if store.tx != nil {
+		return fn(store.tx)
+	}
+	return store.DB.Update(fn)
+}
+
+func poolPut(tx *bolt.Tx, ptx *Transaction) error {
+	var (
+		pool  = tx.Bucket([]byte(BUCKET_MEMPOOL))
+		index = tx.Bucket([]byte(BUCKET_POOLHASH))
+	)
+	if index.Get(ptx.CurrHash) != nil {
+		return errors.New("tx already in mempool")
+	}
+	id, err := pool.NextSequence()
+	if err != nil {
+		return err
+	}
+	err = pool.Put(ToBytes(id), EncodeTX(ptx))
+	if err != nil {
+		return err
+	}
+	return index.Put(ptx.CurrHash, ToBytes(id))
+}
+
+func deleteKeys(bucket *bolt.Bucket, match func(key, value []byte) bool) error {
+	var keys [][]byte
+	bucket.ForEach(func(key, value []byte) error {
+		if match(key, value) {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return nil
+	})
+	for _, key := range keys {
+		err := bucket.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addressKey(address string) []byte {
+	return append([]byte(address), BUCKET_SEP...)
+}
+
+func fromBytes(data []byte) uint64 {
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
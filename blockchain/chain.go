@@ -1,90 +1,253 @@
 package blockchain
 
 import (
-	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
-	"os"
+	"bytes"
+	"errors"
+	"math/big"
 	"time"
 )
 
-func NewChain(filename, receiver string) error {
-	file, err := os.Create(filename)
+func NewChain(backend, filename, receiver string) (*BlockChain, error) {
+	store, err := NewStore(backend, filename)
 	if err != nil {
-		return err
-	}
-	file.Close()
-	db, err := sql.Open("sqlite3", filename)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	_, err = db.Exec(CREATE_TABLE)
-	chain := &BlockChain{
-		DB: db,
+		return nil, err
 	}
 	genesis := &Block{
-		PrevHash: []byte(GENESIS_BLOCK),
+		Version:   CHAIN_VERSION,
+		PrevHash:  []byte(GENESIS_BLOCK),
 		Mapping:   make(map[string]uint64),
 		Miner:     receiver,
 		TimeStamp: time.Now().Format(time.RFC3339),
 	}
-	genesis.Mapping[STORAGE_CHAIN] = STORAGE_VALUE
 	genesis.Mapping[receiver] = GENESIS_REWARD
 	genesis.CurrHash = genesis.hash()
-	chain.AddBlock(genesis)
-	return nil
+	chain := &BlockChain{
+		Store:      store,
+		activation: activationHeight(genesis.Header()),
+		genesis:    genesis.CurrHash,
+	}
+	err = chain.AddBlock(genesis)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return chain, nil
 }
 
-func LoadChain(filename string) *BlockChain {
-	db, err := sql.Open("sqlite3", filename)
+func LoadChain(backend, filename string) *BlockChain {
+	store, err := OpenStore(backend, filename)
 	if err != nil {
 		return nil
 	}
+	if store.Size() == 0 {
+		store.Close()
+		return nil
+	}
 	chain := &BlockChain{
-		DB: db,
+		Store:      store,
+		activation: activationHeight(store.Header(1)),
+		genesis:    store.Hash(1),
 	}
 	return chain
 }
 
 func (chain *BlockChain) Size() uint64 {
-	var size uint64
-	row := chain.DB.QueryRow("SELECT Id FROM BlockChain ORDER BY Id DESC")
-	row.Scan(&size)
-	return size
+	return chain.Store.Size()
+}
+
+func (chain *BlockChain) Block(id uint64) *Block {
+	return chain.Store.Block(id)
 }
 
 func (chain *BlockChain) Balance(address string, size uint64) uint64 {
-	var (
-		sblock  string
-		block   *Block
-		balance uint64
-	)
-	rows, err := chain.DB.Query("SELECT Block FROM BlockChain WHERE Id <= $1 ORDER BY Id DESC", size)
+	balance, _ := chain.Store.Balance(address, size)
+	return balance
+}
+
+func (chain *BlockChain) Supply(size uint64) uint64 {
+	return chain.Store.Supply(size)
+}
+
+func (chain *BlockChain) Nonce(address string, size uint64) uint64 {
+	_, nonce := chain.Store.Balance(address, size)
+	return nonce
+}
+
+func (chain *BlockChain) Rebuild() error {
+	store, err := chain.Store.Begin()
 	if err != nil {
-		return balance
-	}
-	defer rows.Close()
-	for rows.Next() {
-		rows.Scan(&sblock)
-		block = DeserializeBlock(sblock)
-		if value, ok := block.Mapping[address]; ok {
-			balance = value
-			break
+		return err
+	}
+	temp := &BlockChain{
+		Store:      store,
+		activation: chain.activation,
+		genesis:    chain.genesis,
+	}
+	err = store.ClearIndex()
+	if err != nil {
+		store.Rollback()
+		return err
+	}
+	size := temp.Size()
+	for id := uint64(1); id <= size; id++ {
+		block := temp.Block(id)
+		if block == nil {
+			store.Rollback()
+			return errors.New("block is null")
+		}
+		err = temp.addIndex(id, block)
+		if err != nil {
+			store.Rollback()
+			return err
 		}
 	}
-	return balance
+	return store.Commit()
+}
+
+func (chain *BlockChain) Proof(hash []byte) *Proof {
+	blockId, txId, ok := chain.Store.TxIndex(hash)
+	if !ok {
+		return nil
+	}
+	block := chain.Block(blockId)
+	if block == nil {
+		return nil
+	}
+	proof := block.MerkleProof(txId)
+	if proof == nil {
+		return nil
+	}
+	proof.Height = blockId
+	return proof
+}
+
+func (chain *BlockChain) TxInfo(hash []byte) *TxInfo {
+	blockId, txId, ok := chain.Store.TxIndex(hash)
+	if !ok {
+		return nil
+	}
+	block := chain.Block(blockId)
+	if block == nil || txId >= uint64(len(block.Transactions)) {
+		return nil
+	}
+	return &TxInfo{
+		Height:      blockId,
+		Index:       txId,
+		Transaction: block.Transactions[txId],
+	}
+}
+
+func (chain *BlockChain) History(address string) []TxInfo {
+	var history []TxInfo
+	for _, hash := range chain.Store.History(address, HISTORY_LIMIT) {
+		info := chain.TxInfo(hash)
+		if info == nil {
+			continue
+		}
+		history = append(history, *info)
+	}
+	return history
 }
 
 func (chain *BlockChain) LastHash() []byte {
-	var hash string
-	row := chain.DB.QueryRow("SELECT Hash FROM BlockChain ORDER BY Id DESC")
-	row.Scan(&hash)
-	return Base64Decode(hash)
+	return chain.Store.Hash(chain.Size())
+}
+
+func (chain *BlockChain) Work() *big.Int {
+	return chain.Store.Work(chain.Size())
+}
+
+func (chain *BlockChain) AddBlock(block *Block) error {
+	if block == nil {
+		return errors.New("block is null")
+	}
+	if chain.Size() != 0 && !bytes.Equal(block.PrevHash, chain.LastHash()) {
+		return errors.New("prev hash /= last hash")
+	}
+	id := chain.Size() + 1
+	work := new(big.Int).Add(chain.Work(), block.Work())
+	err := chain.Store.Append(id, block, work)
+	if err != nil {
+		return err
+	}
+	err = chain.addIndex(id, block)
+	if err != nil {
+		chain.Store.Truncate(id - 1)
+		return err
+	}
+	return nil
+}
+
+func (chain *BlockChain) addIndex(id uint64, block *Block) error {
+	for i, tx := range block.Transactions {
+		err := chain.Store.AddTx(tx.CurrHash, id, uint64(i))
+		if err != nil {
+			return err
+		}
+		var addresses = map[string]bool{tx.Sender: true}
+		for _, out := range tx.Outputs {
+			addresses[out.Receiver] = true
+		}
+		for address := range addresses {
+			err = chain.Store.AddHistory(address, tx.CurrHash, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for address, balance := range block.Mapping {
+		if address == STORAGE_CHAIN {
+			continue
+		}
+		nonce := chain.Nonce(address, id-1) + block.nonce(address, len(block.Transactions))
+		err := chain.Store.SetBalance(address, id, balance, nonce)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (chain *BlockChain) AddBlock(block *Block) {
-	chain.DB.Exec("INSERT INTO BlockChain (Hash, Block) VALUES ($1, $2)",
-		Base64Encode(block.CurrHash),
-		SerializeBlock(block),
-	)
+func (chain *BlockChain) Difficulty(size uint64) uint8 {
+	difficulty, _ := retarget(size, chain.Header)
+	return difficulty
+}
+
+func (chain *BlockChain) Header(id uint64) *BlockHeader {
+	return chain.Store.Header(id)
+}
+
+func retarget(size uint64, header func(id uint64) *BlockHeader) (uint8, bool) {
+	if size < 2 {
+		return DIFFICULTY, true
+	}
+	lheader := header(size)
+	if lheader == nil {
+		return DIFFICULTY, false
+	}
+	if size%RETARGET_SIZE != 0 {
+		return lheader.Difficulty, true
+	}
+	fheader := header(size - RETARGET_SIZE + 1)
+	if fheader == nil {
+		return lheader.Difficulty, false
+	}
+	ftime, err := time.Parse(time.RFC3339, fheader.TimeStamp)
+	if err != nil {
+		return lheader.Difficulty, true
+	}
+	ltime, err := time.Parse(time.RFC3339, lheader.TimeStamp)
+	if err != nil {
+		return lheader.Difficulty, true
+	}
+	actual := ltime.Sub(ftime)
+	expected := time.Duration(RETARGET_SIZE-1) * BLOCK_TIME * time.Second
+	difficulty := lheader.Difficulty
+	switch {
+	case actual < expected/2 && difficulty < MAX_DIFFICULTY:
+		difficulty++
+	case actual > expected*2 && difficulty > MIN_DIFFICULTY:
+		difficulty--
+	}
+	return difficulty, true
 }
@@ -0,0 +1,69 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestChainAddBlock(t *testing.T) {
+	chain := testChain(t, "alice")
+	genesis := chain.LastHash()
+	block := testBlock(2)
+	block.PrevHash = genesis
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	other := testBlock(3)
+	other.PrevHash = genesis
+	if chain.AddBlock(other) == nil {
+		t.Fatal("block on stale parent accepted")
+	}
+	if chain.AddBlock(nil) == nil {
+		t.Fatal("null block accepted")
+	}
+	if chain.Size() != 2 || !bytes.Equal(chain.LastHash(), block.CurrHash) {
+		t.Fatal("chain changed by rejected block")
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	begin := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	expected := (RETARGET_SIZE - 1) * BLOCK_TIME * time.Second
+	lookup := func(difficulty uint8, span time.Duration, missing uint64) func(id uint64) *BlockHeader {
+		return func(id uint64) *BlockHeader {
+			if id == missing {
+				return nil
+			}
+			return &BlockHeader{
+				Difficulty: difficulty,
+				TimeStamp:  begin.Add(span * time.Duration(id) / (RETARGET_SIZE - 1)).Format(time.RFC3339),
+			}
+		}
+	}
+	tests := []struct {
+		name       string
+		size       uint64
+		header     func(id uint64) *BlockHeader
+		difficulty uint8
+		ok         bool
+	}{
+		{"genesis", 1, lookup(0, expected, 0), DIFFICULTY, true},
+		{"inside window", RETARGET_SIZE + 3, lookup(15, expected/10, 0), 15, true},
+		{"on time", 2 * RETARGET_SIZE, lookup(15, expected, 0), 15, true},
+		{"fast", 2 * RETARGET_SIZE, lookup(15, expected/2-time.Second*(RETARGET_SIZE-1), 0), 16, true},
+		{"slow", 2 * RETARGET_SIZE, lookup(15, expected*2+time.Second*(RETARGET_SIZE-1), 0), 14, true},
+		{"max", 2 * RETARGET_SIZE, lookup(MAX_DIFFICULTY, 0, 0), MAX_DIFFICULTY, true},
+		{"min", 2 * RETARGET_SIZE, lookup(MIN_DIFFICULTY, expected*10, 0), MIN_DIFFICULTY, true},
+		{"no last header", 2 * RETARGET_SIZE, lookup(15, expected, 2*RETARGET_SIZE), DIFFICULTY, false},
+		{"no first header", 2 * RETARGET_SIZE, lookup(15, expected, RETARGET_SIZE+1), 15, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			difficulty, ok := retarget(test.size, test.header)
+			if difficulty != test.difficulty || ok != test.ok {
+				t.Fatalf("retarget = %d %v, want %d %v", difficulty, ok, test.difficulty, test.ok)
+			}
+		})
+	}
+}
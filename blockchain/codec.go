@@ -0,0 +1,267 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+func EncodeBlock(block *Block) []byte {
+	var data = new(bytes.Buffer)
+	codec := codecVersion(block.Version)
+	data.WriteByte(codec)
+	encodeBlock(data, block, codec)
+	return data.Bytes()
+}
+
+func DecodeBlock(data []byte) *Block {
+	dec := &decoder{data: data}
+	codec := dec.byte()
+	if codec != CODEC_LEGACY && codec != CODEC_VERSION {
+		return nil
+	}
+	block := decodeBlock(dec, codec)
+	if dec.err != nil || len(dec.data) != 0 || !bytes.Equal(EncodeBlock(block), data) {
+		return nil
+	}
+	return block
+}
+
+func EncodeTX(tx *Transaction) []byte {
+	var data = new(bytes.Buffer)
+	codec := codecVersion(tx.Version)
+	data.WriteByte(codec)
+	encodeTX(data, tx, codec)
+	return data.Bytes()
+}
+
+func DecodeTX(data []byte) *Transaction {
+	dec := &decoder{data: data}
+	codec := dec.byte()
+	if codec != CODEC_LEGACY && codec != CODEC_VERSION {
+		return nil
+	}
+	tx := decodeTX(dec, codec)
+	if dec.err != nil || len(dec.data) != 0 || !bytes.Equal(EncodeTX(tx), data) {
+		return nil
+	}
+	return tx
+}
+
+func EncodeHeader(header *BlockHeader) []byte {
+	var data = new(bytes.Buffer)
+	codec := codecVersion(header.Version)
+	data.WriteByte(codec)
+	if codec != CODEC_LEGACY {
+		data.WriteByte(header.Version)
+	}
+	writeUvarint(data, header.Nonce)
+	data.WriteByte(header.Difficulty)
+	writeBytes(data, header.CurrHash)
+	writeBytes(data, header.PrevHash)
+	writeBytes(data, header.MerkleRoot)
+	writeBytes(data, header.MappingRoot)
+	writeBytes(data, []byte(header.Miner))
+	writeBytes(data, []byte(header.PublicKey))
+	writeBytes(data, []byte(header.TimeStamp))
+	return data.Bytes()
+}
+
+func DecodeHeader(data []byte) *BlockHeader {
+	dec := &decoder{data: data}
+	codec := dec.byte()
+	if codec != CODEC_LEGACY && codec != CODEC_VERSION {
+		return nil
+	}
+	header := &BlockHeader{}
+	if codec != CODEC_LEGACY {
+		header.Version = dec.byte()
+	}
+	header.Nonce = dec.uvarint()
+	header.Difficulty = dec.byte()
+	header.CurrHash = dec.bytes()
+	header.PrevHash = dec.bytes()
+	header.MerkleRoot = dec.bytes()
+	header.MappingRoot = dec.bytes()
+	header.Miner = dec.string()
+	header.PublicKey = dec.string()
+	header.TimeStamp = dec.string()
+	if dec.err != nil || len(dec.data) != 0 || !bytes.Equal(EncodeHeader(header), data) {
+		return nil
+	}
+	return header
+}
+
+func codecVersion(version uint8) uint8 {
+	if version == LEGACY_VERSION {
+		return CODEC_LEGACY
+	}
+	return CODEC_VERSION
+}
+
+func encodeBlock(data *bytes.Buffer, block *Block, codec uint8) {
+	if codec != CODEC_LEGACY {
+		data.WriteByte(block.Version)
+	}
+	writeUvarint(data, block.Nonce)
+	data.WriteByte(block.Difficulty)
+	writeBytes(data, block.CurrHash)
+	writeBytes(data, block.PrevHash)
+	writeBytes(data, block.MerkleRoot)
+	writeUvarint(data, uint64(len(block.Transactions)))
+	for i := range block.Transactions {
+		encodeTX(data, &block.Transactions[i], codec)
+	}
+	var addresses []string
+	for address := range block.Mapping {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	writeUvarint(data, uint64(len(addresses)))
+	for _, address := range addresses {
+		writeBytes(data, []byte(address))
+		writeUvarint(data, block.Mapping[address])
+	}
+	writeBytes(data, []byte(block.Miner))
+	writeBytes(data, []byte(block.PublicKey))
+	writeBytes(data, block.Signature)
+	writeBytes(data, []byte(block.TimeStamp))
+}
+
+func decodeBlock(dec *decoder, codec uint8) *Block {
+	block := &Block{}
+	if codec != CODEC_LEGACY {
+		block.Version = dec.byte()
+	}
+	block.Nonce = dec.uvarint()
+	block.Difficulty = dec.byte()
+	block.CurrHash = dec.bytes()
+	block.PrevHash = dec.bytes()
+	block.MerkleRoot = dec.bytes()
+	block.Mapping = make(map[string]uint64)
+	lentxs := dec.count(MIN_TX_SIZE)
+	for i := uint64(0); i < lentxs && dec.err == nil; i++ {
+		block.Transactions = append(block.Transactions, *decodeTX(dec, codec))
+	}
+	lenmap := dec.count(MIN_ITEM_SIZE)
+	for i := uint64(0); i < lenmap && dec.err == nil; i++ {
+		address := dec.string()
+		block.Mapping[address] = dec.uvarint()
+	}
+	block.Miner = dec.string()
+	block.PublicKey = dec.string()
+	block.Signature = dec.bytes()
+	block.TimeStamp = dec.string()
+	return block
+}
+
+func encodeTX(data *bytes.Buffer, tx *Transaction, codec uint8) {
+	if codec != CODEC_LEGACY {
+		data.WriteByte(tx.Version)
+	}
+	writeBytes(data, tx.RandBytes)
+	writeUvarint(data, tx.Nonce)
+	writeBytes(data, []byte(tx.Sender))
+	writeBytes(data, []byte(tx.PublicKey))
+	writeUvarint(data, uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		writeBytes(data, []byte(out.Receiver))
+		writeUvarint(data, out.Value)
+	}
+	writeUvarint(data, tx.Fee)
+	writeUvarint(data, tx.Lock)
+	writeBytes(data, tx.CurrHash)
+	writeBytes(data, tx.Signature)
+	writeUvarint(data, uint64(len(tx.Signatures)))
+	for _, sign := range tx.Signatures {
+		writeBytes(data, sign)
+	}
+}
+
+func decodeTX(dec *decoder, codec uint8) *Transaction {
+	tx := &Transaction{}
+	if codec != CODEC_LEGACY {
+		tx.Version = dec.byte()
+	}
+	tx.RandBytes = dec.bytes()
+	tx.Nonce = dec.uvarint()
+	tx.Sender = dec.string()
+	tx.PublicKey = dec.string()
+	lenouts := dec.count(MIN_ITEM_SIZE)
+	for i := uint64(0); i < lenouts && dec.err == nil; i++ {
+		tx.Outputs = append(tx.Outputs, Output{
+			Receiver: dec.string(),
+			Value:    dec.uvarint(),
+		})
+	}
+	tx.Fee = dec.uvarint()
+	tx.Lock = dec.uvarint()
+	tx.CurrHash = dec.bytes()
+	tx.Signature = dec.bytes()
+	lensigns := dec.count(MIN_BYTE_SIZE)
+	for i := uint64(0); i < lensigns && dec.err == nil; i++ {
+		tx.Signatures = append(tx.Signatures, dec.bytes())
+	}
+	return tx
+}
+
+func writeUvarint(data *bytes.Buffer, num uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	data.Write(buffer[:binary.PutUvarint(buffer[:], num)])
+}
+
+func writeBytes(data *bytes.Buffer, value []byte) {
+	writeUvarint(data, uint64(len(value)))
+	data.Write(value)
+}
+
+func (dec *decoder) fail(err error) {
+	if dec.err == nil {
+		dec.err = err
+	}
+	dec.data = nil
+}
+
+func (dec *decoder) byte() byte {
+	if len(dec.data) < 1 {
+		dec.fail(errors.New("unexpected end of data"))
+		return 0
+	}
+	value := dec.data[0]
+	dec.data = dec.data[1:]
+	return value
+}
+
+func (dec *decoder) uvarint() uint64 {
+	value, n := binary.Uvarint(dec.data)
+	if n <= 0 {
+		dec.fail(errors.New("uvarint is not valid"))
+		return 0
+	}
+	dec.data = dec.data[n:]
+	return value
+}
+
+func (dec *decoder) count(size uint64) uint64 {
+	count := dec.uvarint()
+	if count > uint64(len(dec.data))/size {
+		dec.fail(errors.New("count > len data"))
+		return 0
+	}
+	return count
+}
+
+func (dec *decoder) bytes() []byte {
+	size := dec.count(MIN_BYTE_SIZE)
+	if size == 0 {
+		return nil
+	}
+	value := append([]byte{}, dec.data[:size]...)
+	dec.data = dec.data[size:]
+	return value
+}
+
+func (dec *decoder) string() string {
+	return string(dec.bytes())
+}
@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testLegacyBlock(id uint64) *Block {
+	block := testBlock(id)
+	block.Version = LEGACY_VERSION
+	for i := range block.Transactions {
+		block.Transactions[i].Version = LEGACY_VERSION
+	}
+	return block
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *Block
+	}{
+		{"version", testBlock(2)},
+		{"legacy", testLegacyBlock(2)},
+		{"empty", &Block{Version: CHAIN_VERSION, Mapping: map[string]uint64{}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := EncodeBlock(test.block)
+			block := DecodeBlock(data)
+			if block == nil || !bytes.Equal(EncodeBlock(block), data) {
+				t.Fatal("block does not round trip")
+			}
+			header := DecodeHeader(EncodeHeader(test.block.Header()))
+			if header == nil || !header.Matches(test.block) {
+				t.Fatal("header does not round trip")
+			}
+			for i := range test.block.Transactions {
+				data := EncodeTX(&test.block.Transactions[i])
+				tx := DecodeTX(data)
+				if tx == nil || !bytes.Equal(EncodeTX(tx), data) {
+					t.Fatalf("tx %d does not round trip", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecReject(t *testing.T) {
+	var (
+		block = EncodeBlock(testBlock(2))
+		tx    = EncodeTX(&testBlock(2).Transactions[0])
+	)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"codec", append([]byte{9}, block[1:]...)},
+		{"trailing", append(append([]byte{}, block...), 0)},
+		{"truncated", block[:len(block)-1]},
+		{"uvarint", append(append([]byte{}, block[:2]...), append([]byte{0x80, 0x00}, block[3:]...)...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if DecodeBlock(test.data) != nil {
+				t.Fatal("block accepted")
+			}
+		})
+	}
+	if DecodeTX(append(append([]byte{}, tx...), 0)) != nil || DecodeTX(tx[:len(tx)-1]) != nil {
+		t.Fatal("tx accepted")
+	}
+}
+
+func TestCodecCount(t *testing.T) {
+	tests := []struct {
+		name  string
+		count uint64
+	}{
+		{"above limit", 4096},
+		{"below limit", 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data = new(bytes.Buffer)
+			data.WriteByte(CHAIN_VERSION)
+			writeUvarint(data, 0)
+			data.WriteByte(DIFFICULTY)
+			writeBytes(data, nil)
+			writeBytes(data, nil)
+			writeBytes(data, nil)
+			writeUvarint(data, test.count)
+			data.Write(bytes.Repeat([]byte{0xff}, 4096))
+			dec := &decoder{data: data.Bytes()}
+			block := decodeBlock(dec, CODEC_VERSION)
+			if dec.err == nil || len(block.Transactions) > 1 {
+				t.Fatalf("decoded %d transactions", len(block.Transactions))
+			}
+		})
+	}
+}
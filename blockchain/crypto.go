@@ -3,16 +3,21 @@ package blockchain
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"math"
 	"math/big"
 	mrand "math/rand"
+	"strings"
 )
 
 func GeneratePrivate(bits uint) *rsa.PrivateKey {
@@ -37,19 +42,65 @@ func HashSum(data []byte) []byte {
 	return hash[:]
 }
 
-func Sign(priv *rsa.PrivateKey, data []byte) []byte {
-	signature, err := rsa.SignPSS(rand.Reader, priv, crypto.SHA256, data, nil)
-	if err != nil {
-		return nil
+func GenerateKey(scheme string) crypto.Signer {
+	switch scheme {
+	case SCHEME_RSA:
+		if priv := GeneratePrivate(KEY_SIZE); priv != nil {
+			return priv
+		}
+	case SCHEME_ED25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err == nil {
+			return priv
+		}
+	case SCHEME_SECP256K1:
+		priv, err := ethcrypto.GenerateKey()
+		if err == nil {
+			return priv
+		}
+	}
+	return nil
+}
+
+func Sign(priv crypto.PrivateKey, data []byte) []byte {
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		signature, err := rsa.SignPSS(rand.Reader, priv, crypto.SHA256, data, nil)
+		if err != nil {
+			return nil
+		}
+		return signature
+	case ed25519.PrivateKey:
+		return ed25519.Sign(priv, data)
+	case *ecdsa.PrivateKey:
+		signature, err := ethcrypto.Sign(data, priv)
+		if err != nil {
+			return nil
+		}
+		return signature[:64]
 	}
-	return signature
+	return nil
 }
 
-func Verify(pub *rsa.PublicKey, data, sign []byte) error {
-	return rsa.VerifyPSS(pub, crypto.SHA256, data, sign, nil)
+func Verify(pub crypto.PublicKey, data, sign []byte) error {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPSS(pub, crypto.SHA256, data, sign, nil)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, data, sign) {
+			return errors.New("ed25519: verification error")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !ethcrypto.VerifySignature(ethcrypto.CompressPubkey(pub), data, sign) {
+			return errors.New("secp256k1: verification error")
+		}
+		return nil
+	}
+	return errors.New("unknown public key")
 }
 
-func ProofOfWork(blockHash []byte, difficulty uint8, ch chan bool) uint64 {
+func ProofOfWork(version uint8, blockHash []byte, difficulty uint8, ch chan bool) uint64 {
 	var (
 		Target  = big.NewInt(1)
 		intHash = big.NewInt(1)
@@ -65,13 +116,7 @@ func ProofOfWork(blockHash []byte, difficulty uint8, ch chan bool) uint64 {
 			}
 			return nonce
 		default:
-			hash = HashSum(bytes.Join(
-				[][]byte{
-					blockHash,
-					ToBytes(nonce),
-				},
-				[]byte{},
-			))
+			hash = workHash(version, blockHash, nonce)
 			if DEBUG {
 				fmt.Printf("\rMining: %s", Base64Encode(hash))
 			}
@@ -109,26 +154,79 @@ func ToBytes(num uint64) []byte {
 	return data.Bytes()
 }
 
-func StringPublic(pub *rsa.PublicKey) string {
-	return Base64Encode(x509.MarshalPKCS1PublicKey(pub))
+func StringPublic(pub crypto.PublicKey) string {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Base64Encode(x509.MarshalPKCS1PublicKey(pub))
+	case ed25519.PublicKey:
+		return SCHEME_ED25519 + SCHEME_SEP + Base64Encode(pub)
+	case *ecdsa.PublicKey:
+		return SCHEME_SECP256K1 + SCHEME_SEP + Base64Encode(ethcrypto.CompressPubkey(pub))
+	}
+	return ""
 }
 
-func ParsePublic(pubData string) *rsa.PublicKey {
-	pub, err := x509.ParsePKCS1PublicKey(Base64Decode(pubData))
-	if err != nil {
-		return nil
+func ParsePublic(pubData string) crypto.PublicKey {
+	scheme, data := splitScheme(pubData)
+	switch scheme {
+	case SCHEME_RSA:
+		pub, err := x509.ParsePKCS1PublicKey(Base64Decode(data))
+		if err == nil {
+			return pub
+		}
+	case SCHEME_ED25519:
+		pub := Base64Decode(data)
+		if len(pub) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(pub)
+		}
+	case SCHEME_SECP256K1:
+		pub, err := ethcrypto.DecompressPubkey(Base64Decode(data))
+		if err == nil {
+			return pub
+		}
 	}
-	return pub
+	return nil
 }
 
-func StringPrivate(priv *rsa.PrivateKey) string {
-	return Base64Encode(x509.MarshalPKCS1PrivateKey(priv))
+func StringPrivate(priv crypto.PrivateKey) string {
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		return Base64Encode(x509.MarshalPKCS1PrivateKey(priv))
+	case ed25519.PrivateKey:
+		return SCHEME_ED25519 + SCHEME_SEP + Base64Encode(priv.Seed())
+	case *ecdsa.PrivateKey:
+		return SCHEME_SECP256K1 + SCHEME_SEP + Base64Encode(ethcrypto.FromECDSA(priv))
+	}
+	return ""
 }
 
-func ParsePrivate(privData string) *rsa.PrivateKey {
-	pub, err := x509.ParsePKCS1PrivateKey(Base64Decode(privData))
-	if err != nil {
-		return nil
+func ParsePrivate(privData string) crypto.Signer {
+	scheme, data := splitScheme(privData)
+	switch scheme {
+	case SCHEME_RSA:
+		priv, err := x509.ParsePKCS1PrivateKey(Base64Decode(data))
+		if err == nil {
+			return priv
+		}
+	case SCHEME_ED25519:
+		seed := Base64Decode(data)
+		if len(seed) == ed25519.SeedSize {
+			return ed25519.NewKeyFromSeed(seed)
+		}
+	case SCHEME_SECP256K1:
+		priv, err := ethcrypto.ToECDSA(Base64Decode(data))
+		if err == nil {
+			return priv
+		}
+	}
+	return nil
+}
+
+func splitScheme(data string) (string, string) {
+	for _, scheme := range []string{SCHEME_RSA, SCHEME_ED25519, SCHEME_SECP256K1} {
+		if strings.HasPrefix(data, scheme+SCHEME_SEP) {
+			return scheme, strings.TrimPrefix(data, scheme+SCHEME_SEP)
+		}
 	}
-	return pub
+	return SCHEME_RSA, data
 }
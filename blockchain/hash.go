@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"bytes"
+	"math/big"
+)
+
+func (chain *BlockChain) Version(height uint64) uint8 {
+	if height >= chain.activation {
+		return CHAIN_VERSION
+	}
+	return LEGACY_VERSION
+}
+
+func (chain *BlockChain) txVersionIsValid(version uint8, height uint64) bool {
+	if version == chain.Version(height) {
+		return true
+	}
+	return version == LEGACY_VERSION && chain.Version(1) == LEGACY_VERSION &&
+		height < chain.activation+VERSION_GRACE
+}
+
+func activationHeight(genesis *BlockHeader) uint64 {
+	if genesis != nil && genesis.Version != LEGACY_VERSION {
+		return 1
+	}
+	return CANONICAL_HEIGHT
+}
+
+func CanonicalHash(tag string, fields ...[]byte) []byte {
+	var data = new(bytes.Buffer)
+	writeBytes(data, []byte(tag))
+	for _, field := range fields {
+		writeBytes(data, field)
+	}
+	return HashSum(data.Bytes())
+}
+
+func workHash(version uint8, blockHash []byte, nonce uint64) []byte {
+	if version == LEGACY_VERSION {
+		return HashSum(bytes.Join(
+			[][]byte{
+				blockHash,
+				ToBytes(nonce),
+			},
+			[]byte{},
+		))
+	}
+	return CanonicalHash(TAG_WORK, []byte{version}, blockHash, ToBytes(nonce))
+}
+
+func workIsValid(version uint8, blockHash []byte, nonce uint64, difficulty uint8) bool {
+	intHash := big.NewInt(1)
+	Target := big.NewInt(1)
+	intHash.SetBytes(workHash(version, blockHash, nonce))
+	Target.Lsh(Target, 256-uint(difficulty))
+	return intHash.Cmp(Target) == -1
+}
@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		left  []byte
+		right []byte
+	}{
+		{"fields", CanonicalHash(TAG_TRANSACTION, []byte("ab"), []byte("c")), CanonicalHash(TAG_TRANSACTION, []byte("a"), []byte("bc"))},
+		{"empty field", CanonicalHash(TAG_TRANSACTION, []byte("a")), CanonicalHash(TAG_TRANSACTION, []byte("a"), nil)},
+		{"tag", CanonicalHash(TAG_TRANSACTION, []byte("a")), CanonicalHash(TAG_BLOCK, []byte("a"))},
+		{"tag and field", CanonicalHash("ab", []byte("c")), CanonicalHash("a", []byte("bc"))},
+		{"legacy", workHash(LEGACY_VERSION, []byte("block"), 1), workHash(CHAIN_VERSION, []byte("block"), 1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if bytes.Equal(test.left, test.right) {
+				t.Fatal("hashes are equal")
+			}
+		})
+	}
+}
+
+func TestTransactionHashFields(t *testing.T) {
+	var (
+		user    = NewUserScheme(SCHEME_ED25519)
+		genesis = HashSum([]byte("genesis"))
+	)
+	tests := []struct {
+		name   string
+		change func(tx *Transaction)
+	}{
+		{"version", func(tx *Transaction) { tx.Version++ }},
+		{"rand bytes", func(tx *Transaction) { tx.RandBytes = HashSum(tx.RandBytes) }},
+		{"nonce", func(tx *Transaction) { tx.Nonce++ }},
+		{"sender", func(tx *Transaction) { tx.Sender += "a" }},
+		{"public key", func(tx *Transaction) { tx.PublicKey = "key" }},
+		{"receiver", func(tx *Transaction) { tx.Outputs[0].Receiver += "a" }},
+		{"value", func(tx *Transaction) { tx.Outputs[0].Value++ }},
+		{"output", func(tx *Transaction) { tx.Outputs = append(tx.Outputs, Output{Receiver: "receiver", Value: 1}) }},
+		{"fee", func(tx *Transaction) { tx.Fee++ }},
+		{"lock", func(tx *Transaction) { tx.Lock++ }},
+	}
+	for _, version := range []uint8{LEGACY_VERSION, CHAIN_VERSION} {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				tx := NewTransaction(user, genesis, version, 0, "receiver", 1, 0)
+				if !tx.hashIsValid(genesis) {
+					t.Fatal("hash is not valid")
+				}
+				test.change(tx)
+				if tx.hashIsValid(genesis) {
+					t.Fatalf("version %d: hash does not cover %s", version, test.name)
+				}
+			})
+		}
+	}
+}
+
+func TestChainVersion(t *testing.T) {
+	legacy := &BlockChain{activation: CANONICAL_HEIGHT}
+	canonical := &BlockChain{activation: 1}
+	tests := []struct {
+		name    string
+		chain   *BlockChain
+		height  uint64
+		version uint8
+		valid   bool
+	}{
+		{"legacy before activation", legacy, CANONICAL_HEIGHT - 1, LEGACY_VERSION, true},
+		{"canonical before activation", legacy, CANONICAL_HEIGHT - 1, CHAIN_VERSION, false},
+		{"canonical at activation", legacy, CANONICAL_HEIGHT, CHAIN_VERSION, true},
+		{"legacy in grace", legacy, CANONICAL_HEIGHT + VERSION_GRACE - 1, LEGACY_VERSION, true},
+		{"legacy after grace", legacy, CANONICAL_HEIGHT + VERSION_GRACE, LEGACY_VERSION, false},
+		{"canonical chain", canonical, 1, CHAIN_VERSION, true},
+		{"legacy in canonical chain", canonical, 2, LEGACY_VERSION, false},
+		{"unknown", canonical, 2, CHAIN_VERSION + 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := test.chain.txVersionIsValid(test.version, test.height); valid != test.valid {
+				t.Fatalf("txVersionIsValid = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+	if legacy.Version(CANONICAL_HEIGHT-1) != LEGACY_VERSION || legacy.Version(CANONICAL_HEIGHT) != CHAIN_VERSION {
+		t.Fatal("version is not activated at canonical height")
+	}
+	if activationHeight(&BlockHeader{Version: CHAIN_VERSION}) != 1 || activationHeight(&BlockHeader{Version: LEGACY_VERSION}) != CANONICAL_HEIGHT {
+		t.Fatal("activation height is not bound to genesis version")
+	}
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"bytes"
+	"math/big"
+)
+
+func (block *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Version:     block.Version,
+		Nonce:       block.Nonce,
+		Difficulty:  block.Difficulty,
+		CurrHash:    block.CurrHash,
+		PrevHash:    block.PrevHash,
+		MerkleRoot:  block.MerkleRoot,
+		MappingRoot: block.mappingRoot(),
+		Miner:       block.Miner,
+		PublicKey:   block.PublicKey,
+		TimeStamp:   block.TimeStamp,
+	}
+}
+
+func headerOf(block *Block) *BlockHeader {
+	if block == nil {
+		return nil
+	}
+	return block.Header()
+}
+
+func (header *BlockHeader) IsValid(prevHash []byte, version, difficulty uint8) bool {
+	switch {
+	case header == nil:
+		return false
+	case header.Version != version:
+		return false
+	case !bytes.Equal(header.PrevHash, prevHash):
+		return false
+	case header.Difficulty != difficulty:
+		return false
+	case header.Difficulty < MIN_DIFFICULTY || header.Difficulty > MAX_DIFFICULTY:
+		return false
+	case !bytes.Equal(header.hash(), header.CurrHash):
+		return false
+	case !workIsValid(header.Version, header.CurrHash, header.Nonce, header.Difficulty):
+		return false
+	}
+	return true
+}
+
+func (header *BlockHeader) Work() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(header.Difficulty))
+}
+
+func (header *BlockHeader) hash() []byte {
+	if header.Version == LEGACY_VERSION {
+		return HashSum(bytes.Join(
+			[][]byte{
+				header.MappingRoot,
+				ToBytes(uint64(header.Difficulty)),
+				header.PrevHash,
+				[]byte(header.Miner),
+				[]byte(header.PublicKey),
+				[]byte(header.TimeStamp),
+			},
+			[]byte{},
+		))
+	}
+	return CanonicalHash(TAG_BLOCK,
+		[]byte{header.Version},
+		header.MerkleRoot,
+		header.MappingRoot,
+		[]byte{header.Difficulty},
+		header.PrevHash,
+		[]byte(header.Miner),
+		[]byte(header.PublicKey),
+		[]byte(header.TimeStamp),
+	)
+}
+
+func (header *BlockHeader) Matches(block *Block) bool {
+	return block != nil && bytes.Equal(EncodeHeader(block.Header()), EncodeHeader(header))
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"golang.org/x/crypto/scrypt"
+)
+
+func EncryptUser(user *User, pass string) string {
+	return sealKeystore(KEYSTORE_USER, user.Address(), []byte(user.Purse()), pass)
+}
+
+func DecryptUser(data, pass string) *User {
+	keystore, purse := openKeystore(KEYSTORE_USER, data, pass)
+	if keystore == nil {
+		return nil
+	}
+	user := LoadUser(string(purse))
+	if user == nil || user.Address() != keystore.Address {
+		return nil
+	}
+	return user
+}
+
+func ParseKeystore(data string) *Keystore {
+	var keystore Keystore
+	err := json.Unmarshal([]byte(data), &keystore)
+	if err != nil || keystore.Version != KEYSTORE_VERSION {
+		return nil
+	}
+	return &keystore
+}
+
+func sealKeystore(kind, address string, payload []byte, pass string) string {
+	salt := GenerateRandomBytes(SALT_SIZE)
+	aead := newAEAD(pass, salt)
+	if aead == nil {
+		return ""
+	}
+	nonce := GenerateRandomBytes(uint(aead.NonceSize()))
+	keystore := &Keystore{
+		Version: KEYSTORE_VERSION,
+		Kind:    kind,
+		Address: address,
+		Salt:    salt,
+		Nonce:   nonce,
+	}
+	keystore.CipherText = aead.Seal(nil, nonce, payload, []byte(kind+keystore.Address))
+	jsonData, err := json.MarshalIndent(keystore, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(jsonData)
+}
+
+func openKeystore(kind, data, pass string) (*Keystore, []byte) {
+	keystore := ParseKeystore(data)
+	if keystore == nil || keystore.Kind != kind {
+		return nil, nil
+	}
+	aead := newAEAD(pass, keystore.Salt)
+	if aead == nil || len(keystore.Nonce) != aead.NonceSize() {
+		return nil, nil
+	}
+	payload, err := aead.Open(nil, keystore.Nonce, keystore.CipherText, []byte(kind+keystore.Address))
+	if err != nil {
+		return nil, nil
+	}
+	return keystore, payload
+}
+
+func newAEAD(pass string, salt []byte) cipher.AEAD {
+	key, err := scrypt.Key([]byte(pass), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, 32)
+	if err != nil {
+		return nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil
+	}
+	return aead
+}
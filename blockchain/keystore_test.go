@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeystoreUser(t *testing.T) {
+	user := NewUserScheme(SCHEME_ED25519)
+	data := EncryptUser(user, "pass")
+	tests := []struct {
+		name  string
+		data  string
+		pass  string
+		valid bool
+	}{
+		{"user", data, "pass", true},
+		{"wrong pass", data, "other", false},
+		{"empty pass", data, "", false},
+		{"address", strings.Replace(data, user.Address(), NewUserScheme(SCHEME_ED25519).Address(), 1), "pass", false},
+		{"kind", strings.Replace(data, `"`+KEYSTORE_USER+`"`, `"`+KEYSTORE_WALLET+`"`, 1), "pass", false},
+		{"invalid", "keystore", "pass", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loaded := DecryptUser(test.data, test.pass)
+			if (loaded != nil) != test.valid {
+				t.Fatalf("DecryptUser = %v, want valid %v", loaded, test.valid)
+			}
+			if loaded != nil && loaded.Purse() != user.Purse() {
+				t.Fatal("decrypted user is not equal")
+			}
+		})
+	}
+}
+
+func TestKeystoreWallet(t *testing.T) {
+	wallet := NewWallet()
+	wallet.Derive()
+	data := EncryptWallet(wallet, "pass")
+	if DecryptWallet(data, "other") != nil || DecryptUser(data, "pass") != nil {
+		t.Fatal("wallet decrypted with wrong pass or kind")
+	}
+	loaded := DecryptWallet(data, "pass")
+	if loaded == nil || loaded.Mnemonic != wallet.Mnemonic || loaded.Size != wallet.Size {
+		t.Fatal("decrypted wallet is not equal")
+	}
+	if loaded.User(1).Address() != wallet.User(1).Address() {
+		t.Fatal("decrypted wallet derives other users")
+	}
+}
@@ -0,0 +1,345 @@
+package blockchain
+
+import (
+	"errors"
+	"math/big"
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hashes:   make(map[string]uint64),
+		txIndex:  make(map[string][2]uint64),
+		history:  make(map[string][]memoryHistory),
+		balances: make(map[string][]memoryBalance),
+		poolHash: make(map[string]bool),
+	}
+}
+
+func (store *MemoryStore) Size() uint64 {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return uint64(len(store.blocks))
+}
+
+func (store *MemoryStore) Block(id uint64) *Block {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if id == 0 || id > uint64(len(store.blocks)) {
+		return nil
+	}
+	return DecodeBlock(store.blocks[id-1])
+}
+
+func (store *MemoryStore) Hash(id uint64) []byte {
+	header := store.Header(id)
+	if header == nil {
+		return nil
+	}
+	return header.CurrHash
+}
+
+func (store *MemoryStore) Header(id uint64) *BlockHeader {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if id == 0 || id > uint64(len(store.headers)) {
+		return nil
+	}
+	return DecodeHeader(store.headers[id-1])
+}
+
+func (store *MemoryStore) Height(hash []byte) uint64 {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.hashes[string(hash)]
+}
+
+func (store *MemoryStore) Work(id uint64) *big.Int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if id == 0 || id > uint64(len(store.works)) {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(store.works[id-1])
+}
+
+func (store *MemoryStore) Append(id uint64, block *Block, work *big.Int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if id != uint64(len(store.blocks))+1 {
+		return errors.New("block id is not valid")
+	}
+	if _, ok := store.hashes[string(block.CurrHash)]; ok {
+		return errors.New("block already in store")
+	}
+	store.blocks = append(store.blocks, EncodeBlock(block))
+	store.headers = append(store.headers, EncodeHeader(block.Header()))
+	store.works = append(store.works, new(big.Int).Set(work))
+	store.hashes[string(block.CurrHash)] = id
+	return nil
+}
+
+func (store *MemoryStore) Truncate(height uint64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if height < uint64(len(store.blocks)) {
+		store.blocks = store.blocks[:height]
+		store.headers = store.headers[:height]
+		store.works = store.works[:height]
+	}
+	for hash, id := range store.hashes {
+		if id > height {
+			delete(store.hashes, hash)
+		}
+	}
+	for hash, index := range store.txIndex {
+		if index[0] > height {
+			delete(store.txIndex, hash)
+		}
+	}
+	for address, history := range store.history {
+		var kept []memoryHistory
+		for _, entry := range history {
+			if entry.blockId <= height {
+				kept = append(kept, entry)
+			}
+		}
+		store.history[address] = kept
+	}
+	for address, balances := range store.balances {
+		var kept []memoryBalance
+		for _, entry := range balances {
+			if entry.blockId <= height {
+				kept = append(kept, entry)
+			}
+		}
+		store.balances[address] = kept
+	}
+	return nil
+}
+
+func (store *MemoryStore) ClearIndex() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.txIndex = make(map[string][2]uint64)
+	store.history = make(map[string][]memoryHistory)
+	store.balances = make(map[string][]memoryBalance)
+	return nil
+}
+
+func (store *MemoryStore) AddTx(hash []byte, blockId, txId uint64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.txIndex[string(hash)]; ok {
+		return errors.New("tx already in index")
+	}
+	store.txIndex[string(hash)] = [2]uint64{blockId, txId}
+	return nil
+}
+
+func (store *MemoryStore) TxIndex(hash []byte) (uint64, uint64, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	index, ok := store.txIndex[string(hash)]
+	return index[0], index[1], ok
+}
+
+func (store *MemoryStore) AddHistory(address string, hash []byte, blockId uint64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.history[address] = append(store.history[address], memoryHistory{
+		hash:    hash,
+		blockId: blockId,
+	})
+	return nil
+}
+
+func (store *MemoryStore) History(address string, limit int) [][]byte {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	var (
+		history = store.history[address]
+		hashes  [][]byte
+	)
+	for i := len(history) - 1; i >= 0 && len(hashes) < limit; i-- {
+		hashes = append(hashes, history[i].hash)
+	}
+	return hashes
+}
+
+func (store *MemoryStore) SetBalance(address string, blockId, balance, nonce uint64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var (
+		balances = store.balances[address]
+		entry    = memoryBalance{
+			blockId: blockId,
+			balance: balance,
+			nonce:   nonce,
+		}
+	)
+	last := len(balances) - 1
+	if last >= 0 && balances[last].blockId > blockId {
+		return errors.New("balance block id is not valid")
+	}
+	if last >= 0 && balances[last].blockId == blockId {
+		balances[last] = entry
+		return nil
+	}
+	store.balances[address] = append(balances, entry)
+	return nil
+}
+
+func (store *MemoryStore) Balance(address string, size uint64) (uint64, uint64) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	balances := store.balances[address]
+	for i := len(balances) - 1; i >= 0; i-- {
+		if balances[i].blockId <= size {
+			return balances[i].balance, balances[i].nonce
+		}
+	}
+	return 0, 0
+}
+
+func (store *MemoryStore) Supply(size uint64) uint64 {
+	var supply uint64
+	for address := range store.addresses() {
+		balance, _ := store.Balance(address, size)
+		supply += balance
+	}
+	return supply
+}
+
+func (store *MemoryStore) PoolTransactions() []*Transaction {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	var txs []*Transaction
+	for _, stx := range store.pool {
+		tx := DecodeTX(stx)
+		if tx == nil {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func (store *MemoryStore) PoolSize() uint64 {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return uint64(len(store.pool))
+}
+
+func (store *MemoryStore) PoolContains(hash []byte) bool {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.poolHash[string(hash)]
+}
+
+func (store *MemoryStore) PoolAdd(tx *Transaction) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.poolHash[string(tx.CurrHash)] {
+		return errors.New("tx already in mempool")
+	}
+	store.pool = append(store.pool, EncodeTX(tx))
+	store.poolHash[string(tx.CurrHash)] = true
+	return nil
+}
+
+func (store *MemoryStore) PoolReset(txs []*Transaction) error {
+	var (
+		pool     [][]byte
+		poolHash = make(map[string]bool)
+	)
+	for _, tx := range txs {
+		if poolHash[string(tx.CurrHash)] {
+			return errors.New("tx already in mempool")
+		}
+		pool = append(pool, EncodeTX(tx))
+		poolHash[string(tx.CurrHash)] = true
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.pool = pool
+	store.poolHash = poolHash
+	return nil
+}
+
+func (store *MemoryStore) Migrate() error {
+	return nil
+}
+
+func (store *MemoryStore) Begin() (Store, error) {
+	if store.parent != nil {
+		return nil, errors.New("store in transaction")
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	temp := NewMemoryStore()
+	temp.parent = store
+	temp.blocks = append([][]byte{}, store.blocks...)
+	temp.headers = append([][]byte{}, store.headers...)
+	temp.works = append([]*big.Int{}, store.works...)
+	for hash, id := range store.hashes {
+		temp.hashes[hash] = id
+	}
+	for hash, index := range store.txIndex {
+		temp.txIndex[hash] = index
+	}
+	for address, history := range store.history {
+		temp.history[address] = append([]memoryHistory{}, history...)
+	}
+	for address, balances := range store.balances {
+		temp.balances[address] = append([]memoryBalance{}, balances...)
+	}
+	temp.pool = append([][]byte{}, store.pool...)
+	for hash := range store.poolHash {
+		temp.poolHash[hash] = true
+	}
+	return temp, nil
+}
+
+func (store *MemoryStore) Commit() error {
+	if store.parent == nil {
+		return errors.New("store not in transaction")
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	parent := store.parent
+	parent.mutex.Lock()
+	defer parent.mutex.Unlock()
+	parent.blocks = store.blocks
+	parent.headers = store.headers
+	parent.works = store.works
+	parent.hashes = store.hashes
+	parent.txIndex = store.txIndex
+	parent.history = store.history
+	parent.balances = store.balances
+	parent.pool = store.pool
+	parent.poolHash = store.poolHash
+	store.parent = nil
+	return nil
+}
+
+func (store *MemoryStore) Rollback() error {
+	if store.parent == nil {
+		return errors.New("store not in transaction")
+	}
+	store.parent = nil
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+func (store *MemoryStore) addresses() map[string]bool {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	var addresses = make(map[string]bool)
+	for address := range store.balances {
+		addresses[address] = true
+	}
+	return addresses
+}
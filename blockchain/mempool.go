@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+func LoadMempool(chain *BlockChain) *Mempool {
+	if chain == nil {
+		return nil
+	}
+	pool := &Mempool{
+		Store: chain.Store,
+	}
+	pool.Revalidate(chain)
+	return pool
+}
+
+func (pool *Mempool) Size() uint64 {
+	return pool.Store.PoolSize()
+}
+
+func (pool *Mempool) Transactions() []*Transaction {
+	return pool.Store.PoolTransactions()
+}
+
+func (pool *Mempool) Contains(hash []byte) bool {
+	return pool.Store.PoolContains(hash)
+}
+
+func (pool *Mempool) Add(chain *BlockChain, tx *Transaction) error {
+	if tx == nil {
+		return errors.New("tx is null")
+	}
+	if pool.Size() >= MEMPOOL_LIMIT {
+		return errors.New("len mempool = limit")
+	}
+	if tx.Sender == STORAGE_CHAIN {
+		return errors.New("tx sender = storage chain")
+	}
+	for _, out := range tx.Outputs {
+		if !AddressIsValid(out.Receiver) {
+			return errors.New("tx receiver is not valid")
+		}
+	}
+	if !tx.hashIsValid(chain.genesis) {
+		return errors.New("tx hash is not valid")
+	}
+	if !tx.signIsValid() {
+		return errors.New("tx sign is not valid")
+	}
+	if pool.Contains(tx.CurrHash) {
+		return errors.New("tx already in mempool")
+	}
+	if chain.TxInfo(tx.CurrHash) != nil {
+		return errors.New("tx already in chain")
+	}
+	err := pool.txIsValid(chain, tx)
+	if err != nil {
+		return err
+	}
+	err = pool.Store.PoolAdd(tx)
+	if err != nil {
+		return err
+	}
+	if pool.isFinal(chain, tx) {
+		pool.addPending(tx)
+	}
+	return nil
+}
+
+func (pool *Mempool) txIsValid(chain *BlockChain, tx *Transaction) error {
+	size := chain.Size()
+	if !chain.txVersionIsValid(tx.Version, size+1) {
+		return errors.New("tx version is not valid")
+	}
+	if len(tx.Outputs) == 0 || len(tx.Outputs) > OUTPUTS_LIMIT {
+		return errors.New("len outputs = 0 or > limit")
+	}
+	for _, out := range tx.Outputs {
+		if out.Value == 0 {
+			return errors.New("tx value = 0")
+		}
+	}
+	total, ok := tx.Total()
+	if !ok || total+tx.Fee < total {
+		return errors.New("tx value overflow")
+	}
+	if tx.Nonce != chain.Nonce(tx.Sender, size)+pool.nonces[tx.Sender] {
+		return errors.New("nonce in tx /= nonce of sender")
+	}
+	balance := chain.Balance(tx.Sender, size) + pool.received[tx.Sender]
+	spent := pool.spent[tx.Sender] + total + tx.Fee
+	if balance < pool.received[tx.Sender] || spent < total+tx.Fee || balance < spent {
+		return errors.New("insufficient funds")
+	}
+	return nil
+}
+
+func (pool *Mempool) addPending(tx *Transaction) {
+	total, _ := tx.Total()
+	pool.nonces[tx.Sender]++
+	pool.spent[tx.Sender] += total + tx.Fee
+	for _, out := range tx.Outputs {
+		pool.received[out.Receiver] += out.Value
+	}
+}
+
+func (pool *Mempool) Revalidate(chain *BlockChain) {
+	var (
+		valid  []*Transaction
+		locked []*Transaction
+		block  = NewBlock("", chain.LastHash(), 0)
+	)
+	pool.nonces = make(map[string]uint64)
+	pool.spent = make(map[string]uint64)
+	pool.received = make(map[string]uint64)
+	for _, ptx := range pool.Transactions() {
+		if chain.TxInfo(ptx.CurrHash) != nil {
+			continue
+		}
+		if !pool.isFinal(chain, ptx) {
+			locked = append(locked, ptx)
+			continue
+		}
+		if block.appendTransaction(chain, ptx) != nil {
+			continue
+		}
+		pool.addPending(ptx)
+		valid = append(valid, ptx)
+	}
+	for _, ptx := range locked {
+		if block.copy().appendTransaction(chain, ptx) != nil {
+			continue
+		}
+		valid = append(valid, ptx)
+	}
+	pool.Store.PoolReset(valid)
+}
+
+func (pool *Mempool) Nonce(chain *BlockChain, address string) uint64 {
+	return chain.Nonce(address, chain.Size()) + pool.nonces[address]
+}
+
+func (pool *Mempool) isFinal(chain *BlockChain, tx *Transaction) bool {
+	return tx.IsFinal(chain.Size()+1, time.Now())
+}
+
+func (pool *Mempool) Fill(chain *BlockChain, block *Block) {
+	txs := pool.Transactions()
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Fee > txs[j].Fee
+	})
+	for added := true; added; {
+		added = false
+		for i, tx := range txs {
+			if tx == nil {
+				continue
+			}
+			if block.AddTransaction(chain, tx) != nil {
+				continue
+			}
+			txs[i] = nil
+			added = true
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestMempoolAdd(t *testing.T) {
+	var (
+		alice = NewUserScheme(SCHEME_ED25519)
+		bob   = NewUserScheme(SCHEME_ED25519)
+		chain = testChain(t, alice.Address())
+		pool  = LoadMempool(chain)
+	)
+	tests := []struct {
+		name  string
+		tx    *Transaction
+		valid bool
+	}{
+		{"spend", NewTransaction(alice, chain.genesis, CHAIN_VERSION, 0, bob.Address(), 50, 1), true},
+		{"nonce reused", NewTransaction(alice, chain.genesis, CHAIN_VERSION, 0, bob.Address(), 10, 0), false},
+		{"nonce gap", NewTransaction(alice, chain.genesis, CHAIN_VERSION, 2, bob.Address(), 10, 0), false},
+		{"insufficient funds", NewTransaction(alice, chain.genesis, CHAIN_VERSION, 1, bob.Address(), 50, 0), false},
+		{"rest", NewTransaction(alice, chain.genesis, CHAIN_VERSION, 1, bob.Address(), 40, 0), true},
+		{"pending funds", NewTransaction(bob, chain.genesis, CHAIN_VERSION, 0, alice.Address(), 90, 0), true},
+		{"pending overspend", NewTransaction(bob, chain.genesis, CHAIN_VERSION, 1, alice.Address(), 1, 0), false},
+		{"other genesis", NewTransaction(alice, HashSum([]byte("other")), CHAIN_VERSION, 2, bob.Address(), 1, 0), false},
+		{"locked", NewLockedTransaction(alice, chain.genesis, CHAIN_VERSION, 2, bob.Address(), 5, 0, 1000), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := pool.Add(chain, test.tx); (err == nil) != test.valid {
+				t.Fatalf("Add = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+	for _, revalidate := range []bool{false, true} {
+		if revalidate {
+			pool.Revalidate(chain)
+		}
+		if pool.Size() != 4 || pool.Nonce(chain, alice.Address()) != 2 || pool.Nonce(chain, bob.Address()) != 1 {
+			t.Fatalf("size = %d, nonce = %d, revalidate = %v", pool.Size(), pool.Nonce(chain, alice.Address()), revalidate)
+		}
+	}
+}
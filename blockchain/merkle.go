@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"bytes"
+)
+
+func MerkleRoot(version uint8, hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		return nil
+	}
+	level := hashes
+	for len(level) > 1 {
+		level = merkleLevel(version, level)
+	}
+	return level[0]
+}
+
+func MerklePath(version uint8, hashes [][]byte, index uint64) [][]byte {
+	if index >= uint64(len(hashes)) {
+		return nil
+	}
+	var path [][]byte
+	level := hashes
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling >= uint64(len(level)) {
+			sibling = index
+		}
+		path = append(path, level[sibling])
+		level = merkleLevel(version, level)
+		index /= 2
+	}
+	return path
+}
+
+func MerkleVerify(version uint8, root, hash []byte, index uint64, path [][]byte) bool {
+	for _, sibling := range path {
+		if index%2 == 0 {
+			hash = merkleNode(version, hash, sibling)
+		} else {
+			hash = merkleNode(version, sibling, hash)
+		}
+		index /= 2
+	}
+	return index == 0 && bytes.Equal(hash, root)
+}
+
+func (proof *Proof) IsValid() bool {
+	return MerkleVerify(proof.Version, proof.MerkleRoot, proof.TxHash, proof.Index, proof.Path)
+}
+
+func merkleLevel(version uint8, level [][]byte) [][]byte {
+	var next [][]byte
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, merkleNode(version, level[i], level[i+1]))
+		} else {
+			next = append(next, merkleNode(version, level[i], level[i]))
+		}
+	}
+	return next
+}
+
+func merkleNode(version uint8, left, right []byte) []byte {
+	if version != LEGACY_VERSION {
+		return CanonicalHash(TAG_MERKLE, []byte{version}, left, right)
+	}
+	return HashSum(bytes.Join(
+		[][]byte{
+			left,
+			right,
+		},
+		[]byte{},
+	))
+}
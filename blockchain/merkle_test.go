@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMerklePath(t *testing.T) {
+	for _, version := range []uint8{LEGACY_VERSION, CHAIN_VERSION} {
+		for size := uint64(1); size <= 7; size++ {
+			var hashes [][]byte
+			for i := uint64(0); i < size; i++ {
+				hashes = append(hashes, testTxHash(i))
+			}
+			root := MerkleRoot(version, hashes)
+			for index := uint64(0); index < size; index++ {
+				path := MerklePath(version, hashes, index)
+				if !MerkleVerify(version, root, hashes[index], index, path) {
+					t.Fatalf("version %d size %d index %d: proof is not valid", version, size, index)
+				}
+				if MerkleVerify(version, root, testTxHash(size), index, path) {
+					t.Fatalf("version %d size %d index %d: other hash accepted", version, size, index)
+				}
+				if index^1 < size && MerkleVerify(version, root, hashes[index], index^1, path) {
+					t.Fatalf("version %d size %d index %d: other index accepted", version, size, index)
+				}
+				if MerkleVerify(version, root, hashes[index], index+1<<uint(len(path)), path) {
+					t.Fatalf("version %d size %d index %d: index out of path accepted", version, size, index)
+				}
+			}
+			if MerklePath(version, hashes, size) != nil {
+				t.Fatalf("version %d size %d: path out of range", version, size)
+			}
+		}
+	}
+	if MerkleRoot(CHAIN_VERSION, nil) != nil {
+		t.Fatal("root of empty tree")
+	}
+	hashes := [][]byte{testTxHash(0), testTxHash(1)}
+	if bytes.Equal(MerkleRoot(LEGACY_VERSION, hashes), MerkleRoot(CHAIN_VERSION, hashes)) {
+		t.Fatal("versions share merkle root")
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	block := testBlock(1)
+	block.Transactions = append(block.Transactions, testBlock(2).Transactions...)
+	block.MerkleRoot = block.merkleRoot()
+	tests := []struct {
+		name   string
+		change func(proof *Proof)
+		valid  bool
+	}{
+		{"proof", func(proof *Proof) {}, true},
+		{"tx hash", func(proof *Proof) { proof.TxHash = testTxHash(3) }, false},
+		{"index", func(proof *Proof) { proof.Index = 0 }, false},
+		{"root", func(proof *Proof) { proof.MerkleRoot = testTxHash(3) }, false},
+		{"path", func(proof *Proof) { proof.Path = nil }, false},
+		{"version", func(proof *Proof) { proof.Version = LEGACY_VERSION }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof := block.MerkleProof(1)
+			test.change(proof)
+			if valid := proof.IsValid(); valid != test.valid {
+				t.Fatalf("IsValid = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+	if block.MerkleProof(2) != nil {
+		t.Fatal("proof out of range")
+	}
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+func NewMultisig(m int, keys []string) *Multisig {
+	if m < 1 || m > len(keys) || len(keys) > MULTISIG_LIMIT {
+		return nil
+	}
+	var canonical []string
+	for _, key := range keys {
+		pub := ParsePublic(key)
+		if pub == nil {
+			return nil
+		}
+		key = StringPublic(pub)
+		for _, other := range canonical {
+			if key == other {
+				return nil
+			}
+		}
+		canonical = append(canonical, key)
+	}
+	return &Multisig{
+		M:    m,
+		Keys: canonical,
+	}
+}
+
+func ParseMultisig(data string) *Multisig {
+	if !strings.HasPrefix(data, SCHEME_MULTISIG+SCHEME_SEP) {
+		return nil
+	}
+	splited := strings.SplitN(strings.TrimPrefix(data, SCHEME_MULTISIG+SCHEME_SEP), SCHEME_SEP, 2)
+	if len(splited) != 2 {
+		return nil
+	}
+	m, err := strconv.Atoi(splited[0])
+	if err != nil {
+		return nil
+	}
+	return NewMultisig(m, strings.Split(splited[1], MULTISIG_SEP))
+}
+
+func (ms *Multisig) String() string {
+	return SCHEME_MULTISIG + SCHEME_SEP + strconv.Itoa(ms.M) + SCHEME_SEP + strings.Join(ms.Keys, MULTISIG_SEP)
+}
+
+func (ms *Multisig) Address() string {
+	return PublicToAddress(ms.String())
+}
+
+func NewMultisigTransaction(ms *Multisig, genesis []byte, version uint8, nonce uint64, to string, value, fee uint64) *Transaction {
+	tx := &Transaction{
+		Version:    version,
+		RandBytes:  GenerateRandomBytes(RAND_BYTES),
+		Nonce:      nonce,
+		Sender:     ms.Address(),
+		PublicKey:  ms.String(),
+		Outputs:    []Output{{Receiver: to, Value: value}},
+		Fee:        fee,
+		Signatures: make([][]byte, len(ms.Keys)),
+	}
+	tx.CurrHash = tx.hash(genesis)
+	return tx
+}
+
+func (tx *Transaction) Cosign(user *User, genesis []byte) error {
+	ms := ParseMultisig(tx.PublicKey)
+	if ms == nil {
+		return errors.New("tx is not multisig")
+	}
+	if !tx.hashIsValid(genesis) {
+		return errors.New("tx hash is not valid")
+	}
+	if len(tx.Signatures) != len(ms.Keys) {
+		tx.Signatures = make([][]byte, len(ms.Keys))
+	}
+	for i, key := range ms.Keys {
+		if key == user.PublicKey() {
+			tx.Signatures[i] = tx.sign(user.Private())
+			return nil
+		}
+	}
+	return errors.New("user is not cosigner")
+}
+
+func (tx *Transaction) IsSigned() bool {
+	return tx.signIsValid()
+}
+
+func (ms *Multisig) verify(data []byte, signs [][]byte) bool {
+	if len(signs) != len(ms.Keys) {
+		return false
+	}
+	count := 0
+	for i, key := range ms.Keys {
+		if signs[i] == nil {
+			continue
+		}
+		if Verify(ParsePublic(key), data, signs[i]) != nil {
+			return false
+		}
+		count++
+	}
+	return count >= ms.M
+}
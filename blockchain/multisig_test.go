@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestNewMultisig(t *testing.T) {
+	var keys []string
+	for i := 0; i < MULTISIG_LIMIT+1; i++ {
+		keys = append(keys, NewUserScheme(SCHEME_ED25519).PublicKey())
+	}
+	tests := []struct {
+		name  string
+		m     int
+		keys  []string
+		valid bool
+	}{
+		{"1 of 1", 1, keys[:1], true},
+		{"2 of 3", 2, keys[:3], true},
+		{"3 of 3", 3, keys[:3], true},
+		{"limit", MULTISIG_LIMIT, keys[:MULTISIG_LIMIT], true},
+		{"zero", 0, keys[:3], false},
+		{"m > n", 4, keys[:3], false},
+		{"over limit", 1, keys, false},
+		{"duplicate", 1, []string{keys[0], keys[1], keys[0]}, false},
+		{"invalid key", 1, []string{keys[0], "key"}, false},
+		{"no keys", 1, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ms := NewMultisig(test.m, test.keys)
+			if (ms != nil) != test.valid {
+				t.Fatalf("NewMultisig = %v, want valid %v", ms, test.valid)
+			}
+			if ms != nil && ParseMultisig(ms.String()).Address() != ms.Address() {
+				t.Fatal("parsed multisig is not equal")
+			}
+		})
+	}
+}
+
+func TestMultisigCosign(t *testing.T) {
+	var (
+		users   []*User
+		keys    []string
+		genesis = HashSum([]byte("genesis"))
+	)
+	for i := 0; i < 3; i++ {
+		users = append(users, NewUserScheme(SCHEME_ED25519))
+		keys = append(keys, users[i].PublicKey())
+	}
+	ms := NewMultisig(2, keys)
+	tests := []struct {
+		name    string
+		signers []*User
+		signed  bool
+	}{
+		{"none", nil, false},
+		{"1 of 2", users[:1], false},
+		{"2 of 2", users[:2], true},
+		{"3 of 2", users, true},
+		{"same signer", []*User{users[2], users[2]}, false},
+		{"other signers", []*User{users[0], users[2]}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := NewMultisigTransaction(ms, genesis, CHAIN_VERSION, 0, "receiver", 1, 0)
+			for _, user := range test.signers {
+				if err := tx.Cosign(user, genesis); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if signed := tx.IsSigned(); signed != test.signed {
+				t.Fatalf("IsSigned = %v, want %v", signed, test.signed)
+			}
+		})
+	}
+	tx := NewMultisigTransaction(ms, genesis, CHAIN_VERSION, 0, "receiver", 1, 0)
+	if tx.Cosign(NewUserScheme(SCHEME_ED25519), genesis) == nil {
+		t.Fatal("cosigned by other user")
+	}
+	if tx.Cosign(users[0], HashSum([]byte("other"))) == nil {
+		t.Fatal("cosigned for other chain")
+	}
+	single := NewTransaction(users[0], genesis, CHAIN_VERSION, 0, "receiver", 1, 0)
+	if single.Cosign(users[0], genesis) == nil {
+		t.Fatal("cosigned single sign tx")
+	}
+}
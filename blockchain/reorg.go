@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+func (chain *BlockChain) Reorganize(fork *Fork) ([]*Block, error) {
+	if fork == nil || len(fork.Blocks) == 0 {
+		return nil, errors.New("fork is empty")
+	}
+	var orphans []*Block
+	size := chain.Size()
+	for id := fork.Height + 1; id <= size; id++ {
+		block := chain.Block(id)
+		if block == nil {
+			return nil, errors.New("block is null")
+		}
+		orphans = append(orphans, block)
+	}
+	work := chain.Work()
+	store, err := chain.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	temp := &BlockChain{
+		Store:      store,
+		activation: chain.activation,
+		genesis:    chain.genesis,
+	}
+	err = store.Truncate(fork.Height)
+	if err != nil {
+		store.Rollback()
+		return nil, err
+	}
+	for i, block := range fork.Blocks {
+		if !block.IsValid(temp, fork.Height+uint64(i)) {
+			store.Rollback()
+			return nil, errors.New("block in fork is not valid")
+		}
+		err = temp.AddBlock(block)
+		if err != nil {
+			store.Rollback()
+			return nil, err
+		}
+	}
+	if temp.Work().Cmp(work) <= 0 {
+		store.Rollback()
+		return nil, errors.New("fork work <= chain work")
+	}
+	return orphans, store.Commit()
+}
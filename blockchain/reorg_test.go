@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReorganize(t *testing.T) {
+	user := NewUserScheme(SCHEME_ED25519)
+	chain := testChain(t, user.Address())
+	store, err := NewStore(STORE_MEMORY, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	fork := &BlockChain{
+		Store:      store,
+		activation: chain.activation,
+		genesis:    chain.genesis,
+	}
+	if err = fork.AddBlock(chain.Block(1)); err != nil {
+		t.Fatal(err)
+	}
+	testMine(t, chain, user, 1)
+	testMine(t, fork, user, 2)
+	last := chain.LastHash()
+	work := chain.Work()
+	tests := []struct {
+		name   string
+		blocks []*Block
+		valid  bool
+	}{
+		{"empty", nil, false},
+		{"equal work", []*Block{fork.Block(2)}, false},
+		{"not linked", []*Block{fork.Block(3)}, false},
+		{"more work", []*Block{fork.Block(2), fork.Block(3)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			orphans, err := chain.Reorganize(&Fork{Height: 1, Blocks: test.blocks})
+			if (err == nil) != test.valid {
+				t.Fatalf("Reorganize = %v, want valid %v", err, test.valid)
+			}
+			if !test.valid {
+				if chain.Size() != 2 || !bytes.Equal(chain.LastHash(), last) || chain.Work().Cmp(work) != 0 {
+					t.Fatal("chain changed by rejected fork")
+				}
+				return
+			}
+			if len(orphans) != 1 || !bytes.Equal(orphans[0].CurrHash, last) {
+				t.Fatal("orphans are not valid")
+			}
+			if chain.Size() != 3 || !bytes.Equal(chain.LastHash(), fork.LastHash()) || chain.Work().Cmp(fork.Work()) != 0 {
+				t.Fatal("chain is not reorganized")
+			}
+		})
+	}
+}
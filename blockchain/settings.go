@@ -2,7 +2,10 @@ package blockchain
 
 import (
 	"database/sql"
+	bolt "go.etcd.io/bbolt"
+	"math/big"
 	mrand "math/rand"
+	"sync"
 	"time"
 )
 
@@ -12,51 +15,310 @@ func init() {
 
 const (
 	CREATE_TABLE = `
-CREATE TABLE BlockChain (
+CREATE TABLE IF NOT EXISTS BlockChain (
     Id INTEGER PRIMARY KEY AUTOINCREMENT,
     Hash VARCHAR(44) UNIQUE,
-    Block TEXT
+    Block BLOB,
+    Header BLOB,
+    Work TEXT
 );
 `
+	CREATE_INDEX = `
+CREATE TABLE IF NOT EXISTS TxIndex (
+    Hash VARCHAR(44) PRIMARY KEY,
+    BlockId INTEGER,
+    TxId INTEGER
+);
+CREATE TABLE IF NOT EXISTS AddrIndex (
+    Address TEXT,
+    Hash VARCHAR(44),
+    BlockId INTEGER
+);
+CREATE INDEX IF NOT EXISTS AddrIndexAddress ON AddrIndex (Address);
+CREATE TABLE IF NOT EXISTS Balances (
+    Address TEXT,
+    BlockId INTEGER,
+    Balance INTEGER,
+    Nonce INTEGER,
+    PRIMARY KEY (Address, BlockId)
+);
+`
+	CREATE_MEMPOOL = `
+CREATE TABLE IF NOT EXISTS Mempool (
+    Id INTEGER PRIMARY KEY AUTOINCREMENT,
+    Hash VARCHAR(44) UNIQUE,
+    TX BLOB
+);
+`
+)
+
+const (
+	CODEC_LEGACY  = 1
+	CODEC_VERSION = 2
+	MIN_TX_SIZE   = 10
+	MIN_ITEM_SIZE = 2
+	MIN_BYTE_SIZE = 1
+)
+
+const (
+	LEGACY_VERSION   = 0
+	CHAIN_VERSION    = 1
+	CANONICAL_HEIGHT = 2000
+	VERSION_GRACE    = 1000
+	TAG_TRANSACTION  = "transaction"
+	TAG_BLOCK        = "block-header"
+	TAG_MERKLE       = "merkle-node"
+	TAG_MAPPING      = "block-mapping"
+	TAG_WORK         = "proof-of-work"
+)
+
+const (
+	STORE_SQLITE  = "sqlite"
+	STORE_MEMORY  = "memory"
+	STORE_BOLT    = "bolt"
+	DEFAULT_STORE = STORE_SQLITE
+)
+
+const (
+	BUCKET_BLOCKS   = "blocks"
+	BUCKET_HEADERS  = "headers"
+	BUCKET_HASHES   = "hashes"
+	BUCKET_WORK     = "work"
+	BUCKET_TXINDEX  = "txindex"
+	BUCKET_ADDRESS  = "addrindex"
+	BUCKET_BALANCES = "balances"
+	BUCKET_MEMPOOL  = "mempool"
+	BUCKET_POOLHASH = "poolhash"
+	BUCKET_SEP      = "\x00"
+)
+
+const (
+	SCHEME_RSA       = "rsa"
+	SCHEME_ED25519   = "ed25519"
+	SCHEME_SECP256K1 = "secp256k1"
+	SCHEME_MULTISIG  = "multisig"
+	MULTISIG_SEP     = ","
+	MULTISIG_LIMIT   = 16
+	SCHEME_SEP       = ":"
+	DEFAULT_SCHEME   = SCHEME_ED25519
+)
+
+const (
+	BASE58_ALPHABET = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	ADDRESS_VERSION = 0x00
+	ADDRESS_SIZE    = 20
+	CHECKSUM_SIZE   = 4
+)
+
+const (
+	KEYSTORE_VERSION = 1
+	KEYSTORE_USER    = "user"
+	KEYSTORE_WALLET  = "wallet"
+	SALT_SIZE        = 32
+	SCRYPT_N         = 1 << 15
+	SCRYPT_R         = 8
+	SCRYPT_P         = 1
+)
+
+const (
+	MNEMONIC_BITS = 128
+	HD_SEED_KEY   = "ed25519 seed"
+	HD_PURPOSE    = 44
+	HD_COIN       = 571
+	HD_HARDENED   = 1 << 31
 )
 
 const (
-	DEBUG          = true
-	KEY_SIZE       = 512
-	STORAGE_CHAIN  = "STORAGE-CHAIN"
-	STORAGE_VALUE  = 100
-	STORAGE_REWARD = 1
-	GENESIS_BLOCK  = "GENESIS-BLOCK"
-	GENESIS_REWARD = 100
-	DIFFICULTY     = 20
-	TXS_LIMIT      = 2
-	START_PERCENT  = 10
-	RAND_BYTES     = 32
+	DEBUG            = true
+	KEY_SIZE         = 512
+	STORAGE_CHAIN    = "STORAGE-CHAIN"
+	INITIAL_SUBSIDY  = 50
+	HALVING_INTERVAL = 1000
+	GENESIS_BLOCK    = "GENESIS-BLOCK"
+	GENESIS_REWARD   = 100
+	DIFFICULTY       = 20
+	MIN_DIFFICULTY   = 8
+	MAX_DIFFICULTY   = 64
+	RETARGET_SIZE    = 10
+	BLOCK_TIME       = 30          // seconds
+	BLOCK_SIZE       = (512 << 10) // (2^10)*512 = 512KiB, with headroom under network DMAXSIZE
+	BLOCK_RESERVE    = (4 << 10)   // (2^10)*4 = 4KiB, for coinbase and header
+	MAPPING_ENTRY    = 24
+	RAND_BYTES       = 32
+	HISTORY_LIMIT    = 100
+	HEADERS_LIMIT    = 1000
+	BLOCKS_LIMIT     = 500
+	LOCK_THRESHOLD   = 500000000
+	OUTPUTS_LIMIT    = 256
+	MEMPOOL_LIMIT    = 1000
 )
 
 type BlockChain struct {
-	DB    *sql.DB
+	Store      Store
+	activation uint64
+	genesis    []byte
+}
+
+type Store interface {
+	Size() uint64
+	Block(id uint64) *Block
+	Hash(id uint64) []byte
+	Header(id uint64) *BlockHeader
+	Height(hash []byte) uint64
+	Work(id uint64) *big.Int
+	Append(id uint64, block *Block, work *big.Int) error
+	Truncate(height uint64) error
+	ClearIndex() error
+	AddTx(hash []byte, blockId, txId uint64) error
+	TxIndex(hash []byte) (uint64, uint64, bool)
+	AddHistory(address string, hash []byte, blockId uint64) error
+	History(address string, limit int) [][]byte
+	SetBalance(address string, blockId, balance, nonce uint64) error
+	Balance(address string, size uint64) (uint64, uint64)
+	Supply(size uint64) uint64
+	PoolTransactions() []*Transaction
+	PoolSize() uint64
+	PoolContains(hash []byte) bool
+	PoolAdd(tx *Transaction) error
+	PoolReset(txs []*Transaction) error
+	Migrate() error
+	Begin() (Store, error)
+	Commit() error
+	Rollback() error
+	Close() error
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+type SQLiteStore struct {
+	DB *sql.DB
+	tx *sql.Tx
+}
+
+type MemoryStore struct {
+	mutex    sync.RWMutex
+	parent   *MemoryStore
+	blocks   [][]byte
+	headers  [][]byte
+	works    []*big.Int
+	hashes   map[string]uint64
+	txIndex  map[string][2]uint64
+	history  map[string][]memoryHistory
+	balances map[string][]memoryBalance
+	pool     [][]byte
+	poolHash map[string]bool
+}
+
+type memoryHistory struct {
+	hash    []byte
+	blockId uint64
+}
+
+type memoryBalance struct {
+	blockId uint64
+	balance uint64
+	nonce   uint64
+}
+
+type BoltStore struct {
+	DB *bolt.DB
+	tx *bolt.Tx
+}
+
+type Keystore struct {
+	Version    int
+	Kind       string
+	Address    string
+	Salt       []byte
+	Nonce      []byte
+	CipherText []byte
+}
+
+type Multisig struct {
+	M    int
+	Keys []string
+}
+
+type Wallet struct {
+	Mnemonic string
+	Size     uint32
+	seed     []byte
+}
+
+type Mempool struct {
+	Store    Store
+	nonces   map[string]uint64
+	spent    map[string]uint64
+	received map[string]uint64
+}
+
+type Fork struct {
+	Height uint64
+	Blocks []*Block
 }
 
 type Block struct {
+	Version      uint8
 	Nonce        uint64
 	Difficulty   uint8
 	CurrHash     []byte
 	PrevHash     []byte
+	MerkleRoot   []byte
 	Transactions []Transaction
 	Mapping      map[string]uint64
 	Miner        string
+	PublicKey    string
 	Signature    []byte
 	TimeStamp    string
+	size         int
+}
+
+type BlockHeader struct {
+	Version     uint8
+	Nonce       uint64
+	Difficulty  uint8
+	CurrHash    []byte
+	PrevHash    []byte
+	MerkleRoot  []byte
+	MappingRoot []byte
+	Miner       string
+	PublicKey   string
+	TimeStamp   string
+}
+
+type Proof struct {
+	Version    uint8
+	Height     uint64
+	Index      uint64
+	TxHash     []byte
+	MerkleRoot []byte
+	Path       [][]byte
+}
+
+type TxInfo struct {
+	Height      uint64
+	Index       uint64
+	Transaction Transaction
+}
+
+type Output struct {
+	Receiver string
+	Value    uint64
 }
 
 type Transaction struct {
-	RandBytes []byte
-	PrevBlock []byte
-	Sender    string
-	Receiver  string
-	Value     uint64
-	ToStorage uint64
-	CurrHash  []byte
-	Signature []byte
+	Version    uint8
+	RandBytes  []byte
+	Nonce      uint64
+	Sender     string
+	PublicKey  string
+	Outputs    []Output
+	Fee        uint64
+	Lock       uint64
+	CurrHash   []byte
+	Signature  []byte
+	Signatures [][]byte
 }
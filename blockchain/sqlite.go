@@ -0,0 +1,452 @@
+package blockchain
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	_ "github.com/mattn/go-sqlite3"
+	"math/big"
+)
+
+func OpenSQLiteStore(filename string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	store := &SQLiteStore{
+		DB: db,
+	}
+	err = store.upgrade()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *SQLiteStore) Size() uint64 {
+	var size uint64
+	row := store.query().QueryRow("SELECT Id FROM BlockChain ORDER BY Id DESC")
+	row.Scan(&size)
+	return size
+}
+
+func (store *SQLiteStore) Block(id uint64) *Block {
+	var data []byte
+	row := store.query().QueryRow("SELECT Block FROM BlockChain WHERE Id=$1", id)
+	row.Scan(&data)
+	return DecodeBlock(data)
+}
+
+func (store *SQLiteStore) Hash(id uint64) []byte {
+	var hash string
+	row := store.query().QueryRow("SELECT Hash FROM BlockChain WHERE Id=$1", id)
+	if row.Scan(&hash) != nil {
+		return nil
+	}
+	return Base64Decode(hash)
+}
+
+func (store *SQLiteStore) Height(hash []byte) uint64 {
+	var id uint64
+	row := store.query().QueryRow("SELECT Id FROM BlockChain WHERE Hash=$1", Base64Encode(hash))
+	row.Scan(&id)
+	return id
+}
+
+func (store *SQLiteStore) Header(id uint64) *BlockHeader {
+	var header, block []byte
+	row := store.query().QueryRow("SELECT Header, Block FROM BlockChain WHERE Id=$1", id)
+	if row.Scan(&header, &block) != nil {
+		return nil
+	}
+	if header == nil {
+		return headerOf(DecodeBlock(block))
+	}
+	return DecodeHeader(header)
+}
+
+func (store *SQLiteStore) Work(id uint64) *big.Int {
+	var swork string
+	row := store.query().QueryRow("SELECT Work FROM BlockChain WHERE Id=$1", id)
+	row.Scan(&swork)
+	work, ok := new(big.Int).SetString(swork, 10)
+	if !ok {
+		return big.NewInt(0)
+	}
+	return work
+}
+
+func (store *SQLiteStore) Append(id uint64, block *Block, work *big.Int) error {
+	if id != store.Size()+1 {
+		return errors.New("block id is not valid")
+	}
+	_, err := store.query().Exec("INSERT INTO BlockChain (Id, Hash, Block, Header, Work) VALUES ($1, $2, $3, $4, $5)",
+		id,
+		Base64Encode(block.CurrHash),
+		EncodeBlock(block),
+		EncodeHeader(block.Header()),
+		work.String(),
+	)
+	return err
+}
+
+func (store *SQLiteStore) Truncate(height uint64) error {
+	for _, query := range []string{
+		"DELETE FROM BlockChain WHERE Id > $1",
+		"DELETE FROM TxIndex WHERE BlockId > $1",
+		"DELETE FROM AddrIndex WHERE BlockId > $1",
+		"DELETE FROM Balances WHERE BlockId > $1",
+	} {
+		_, err := store.query().Exec(query, height)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) ClearIndex() error {
+	err := store.upgrade()
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM TxIndex",
+		"DELETE FROM AddrIndex",
+		"DELETE FROM Balances",
+	} {
+		_, err := store.query().Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) AddTx(hash []byte, blockId, txId uint64) error {
+	_, err := store.query().Exec("INSERT INTO TxIndex (Hash, BlockId, TxId) VALUES ($1, $2, $3)",
+		Base64Encode(hash), blockId, txId)
+	return err
+}
+
+func (store *SQLiteStore) TxIndex(hash []byte) (uint64, uint64, bool) {
+	var blockId, txId uint64
+	row := store.query().QueryRow("SELECT BlockId, TxId FROM TxIndex WHERE Hash=$1",
+		Base64Encode(hash))
+	if row.Scan(&blockId, &txId) != nil {
+		return 0, 0, false
+	}
+	return blockId, txId, true
+}
+
+func (store *SQLiteStore) AddHistory(address string, hash []byte, blockId uint64) error {
+	_, err := store.query().Exec("INSERT INTO AddrIndex (Address, Hash, BlockId) VALUES ($1, $2, $3)",
+		address, Base64Encode(hash), blockId)
+	return err
+}
+
+func (store *SQLiteStore) History(address string, limit int) [][]byte {
+	var (
+		hash   string
+		hashes [][]byte
+	)
+	rows, err := store.query().Query("SELECT Hash FROM AddrIndex WHERE Address=$1 ORDER BY BlockId DESC LIMIT $2",
+		address, limit)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rows.Scan(&hash)
+		hashes = append(hashes, Base64Decode(hash))
+	}
+	return hashes
+}
+
+func (store *SQLiteStore) SetBalance(address string, blockId, balance, nonce uint64) error {
+	_, err := store.query().Exec("INSERT OR REPLACE INTO Balances (Address, BlockId, Balance, Nonce) VALUES ($1, $2, $3, $4)",
+		address, blockId, balance, nonce)
+	return err
+}
+
+func (store *SQLiteStore) Balance(address string, size uint64) (uint64, uint64) {
+	var balance, nonce uint64
+	row := store.query().QueryRow("SELECT Balance, Nonce FROM Balances WHERE Address=$1 AND BlockId <= $2 ORDER BY BlockId DESC LIMIT 1",
+		address, size)
+	row.Scan(&balance, &nonce)
+	return balance, nonce
+}
+
+func (store *SQLiteStore) Supply(size uint64) uint64 {
+	var supply uint64
+	row := store.query().QueryRow(`SELECT COALESCE(SUM(Balance), 0) FROM Balances b WHERE BlockId = (
+    SELECT MAX(BlockId) FROM Balances WHERE Address=b.Address AND BlockId <= $1)`, size)
+	row.Scan(&supply)
+	return supply
+}
+
+func (store *SQLiteStore) PoolTransactions() []*Transaction {
+	var (
+		stx []byte
+		txs []*Transaction
+	)
+	rows, err := store.query().Query("SELECT TX FROM Mempool ORDER BY Id")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rows.Scan(&stx)
+		tx := DecodeTX(stx)
+		if tx == nil {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func (store *SQLiteStore) PoolSize() uint64 {
+	var size uint64
+	row := store.query().QueryRow("SELECT COUNT(*) FROM Mempool")
+	row.Scan(&size)
+	return size
+}
+
+func (store *SQLiteStore) PoolContains(hash []byte) bool {
+	var count uint64
+	row := store.query().QueryRow("SELECT COUNT(*) FROM Mempool WHERE Hash=$1",
+		Base64Encode(hash),
+	)
+	row.Scan(&count)
+	return count != 0
+}
+
+func (store *SQLiteStore) PoolAdd(tx *Transaction) error {
+	_, err := store.query().Exec("INSERT INTO Mempool (Hash, TX) VALUES ($1, $2)",
+		Base64Encode(tx.CurrHash),
+		EncodeTX(tx),
+	)
+	return err
+}
+
+func (store *SQLiteStore) PoolReset(txs []*Transaction) error {
+	temp, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = temp.(*SQLiteStore).tx.Exec("DELETE FROM Mempool")
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	for _, tx := range txs {
+		err = temp.PoolAdd(tx)
+		if err != nil {
+			temp.Rollback()
+			return err
+		}
+	}
+	return temp.Commit()
+}
+
+func (store *SQLiteStore) Migrate() error {
+	temp, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	err = temp.(*SQLiteStore).upgrade()
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	err = temp.(*SQLiteStore).migrate("BlockChain", "Block", migrateBlock)
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	err = temp.(*SQLiteStore).migrate("Mempool", "TX", migrateTX)
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	err = temp.(*SQLiteStore).migrateWork()
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	err = temp.(*SQLiteStore).migrateHeader()
+	if err != nil {
+		temp.Rollback()
+		return err
+	}
+	return temp.Commit()
+}
+
+func (store *SQLiteStore) Begin() (Store, error) {
+	if store.tx != nil {
+		return nil, errors.New("store in transaction")
+	}
+	tx, err := store.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{
+		DB: store.DB,
+		tx: tx,
+	}, nil
+}
+
+func (store *SQLiteStore) Commit() error {
+	if store.tx == nil {
+		return errors.New("store not in transaction")
+	}
+	return store.tx.Commit()
+}
+
+func (store *SQLiteStore) Rollback() error {
+	if store.tx == nil {
+		return errors.New("store not in transaction")
+	}
+	return store.tx.Rollback()
+}
+
+func (store *SQLiteStore) Close() error {
+	return store.DB.Close()
+}
+
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (store *SQLiteStore) query() querier {
+	if store.tx != nil {
+		return store.tx
+	}
+	return store.DB
+}
+
+func (store *SQLiteStore) migrate(table, column string, convert func([]byte) ([]byte, error)) error {
+	var (
+		id     uint64
+		value  []byte
+		values = make(map[uint64][]byte)
+	)
+	rows, err := store.query().Query("SELECT Id, " + column + " FROM " + table)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		rows.Scan(&id, &value)
+		data, err := convert(value)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if !bytes.Equal(data, value) {
+			values[id] = data
+		}
+	}
+	rows.Close()
+	for id, data := range values {
+		_, err = store.query().Exec("UPDATE "+table+" SET "+column+"=$1 WHERE Id=$2", data, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) upgrade() error {
+	_, err := store.query().Exec(CREATE_TABLE + CREATE_INDEX + CREATE_MEMPOOL)
+	if err != nil {
+		return err
+	}
+	for _, column := range [][3]string{
+		{"BlockChain", "Work", "TEXT"},
+		{"BlockChain", "Header", "BLOB"},
+		{"Balances", "Nonce", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		var count int
+		row := store.query().QueryRow("SELECT COUNT(*) FROM pragma_table_info($1) WHERE name=$2",
+			column[0], column[1])
+		err = row.Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			continue
+		}
+		_, err = store.query().Exec("ALTER TABLE " + column[0] + " ADD COLUMN " + column[1] + " " + column[2])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) migrateWork() error {
+	var (
+		id    uint64
+		data  []byte
+		swork sql.NullString
+		work  = big.NewInt(0)
+		works = make(map[uint64]string)
+	)
+	rows, err := store.query().Query("SELECT Id, Block, Work FROM BlockChain ORDER BY Id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		rows.Scan(&id, &data, &swork)
+		block := DecodeBlock(data)
+		if block == nil {
+			rows.Close()
+			return errors.New("block is not valid")
+		}
+		work.Add(work, block.Work())
+		if swork.String != work.String() {
+			works[id] = work.String()
+		}
+	}
+	rows.Close()
+	for id, swork := range works {
+		_, err = store.query().Exec("UPDATE BlockChain SET Work=$1 WHERE Id=$2", swork, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) migrateHeader() error {
+	var (
+		id      uint64
+		data    []byte
+		headers = make(map[uint64][]byte)
+	)
+	rows, err := store.query().Query("SELECT Id, Block FROM BlockChain WHERE Header IS NULL")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		rows.Scan(&id, &data)
+		block := DecodeBlock(data)
+		if block == nil {
+			rows.Close()
+			return errors.New("block is not valid")
+		}
+		headers[id] = EncodeHeader(block.Header())
+	}
+	rows.Close()
+	for id, header := range headers {
+		_, err = store.query().Exec("UPDATE BlockChain SET Header=$1 WHERE Id=$2", header, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+func NewStore(backend, filename string) (Store, error) {
+	switch backend {
+	case STORE_MEMORY:
+		return NewMemoryStore(), nil
+	case STORE_SQLITE, STORE_BOLT:
+		err := os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return OpenStore(backend, filename)
+	}
+	return nil, errors.New("unknown store backend")
+}
+
+func OpenStore(backend, filename string) (Store, error) {
+	switch backend {
+	case STORE_SQLITE:
+		return OpenSQLiteStore(filename)
+	case STORE_MEMORY:
+		return NewMemoryStore(), nil
+	case STORE_BOLT:
+		return OpenBoltStore(filename)
+	}
+	return nil, errors.New("unknown store backend")
+}
+
+func migrateBlock(value []byte) ([]byte, error) {
+	if DecodeBlock(value) != nil {
+		return value, nil
+	}
+	if unsupportedBlock(value) {
+		return nil, errors.New("legacy JSON chain format is not supported")
+	}
+	block := DeserializeBlock(string(value))
+	if block == nil {
+		return nil, errors.New("block is not valid")
+	}
+	return EncodeBlock(block), nil
+}
+
+func migrateTX(value []byte) ([]byte, error) {
+	if DecodeTX(value) != nil {
+		return value, nil
+	}
+	if unsupportedTX(value) {
+		return nil, errors.New("legacy JSON chain format is not supported")
+	}
+	tx := DeserializeTX(string(value))
+	if tx == nil {
+		return nil, errors.New("tx is not valid")
+	}
+	return EncodeTX(tx), nil
+}
+
+func unsupportedBlock(value []byte) bool {
+	var block map[string]json.RawMessage
+	if json.Unmarshal(value, &block) != nil {
+		return false
+	}
+	if _, ok := block["MerkleRoot"]; !ok {
+		return true
+	}
+	var txs []json.RawMessage
+	json.Unmarshal(block["Transactions"], &txs)
+	for _, tx := range txs {
+		if unsupportedTX(tx) {
+			return true
+		}
+	}
+	return false
+}
+
+func unsupportedTX(value []byte) bool {
+	var tx map[string]json.RawMessage
+	if json.Unmarshal(value, &tx) != nil {
+		return false
+	}
+	for _, field := range []string{"PrevBlock", "Receiver", "Value", "ToStorage"} {
+		if _, ok := tx[field]; ok {
+			return true
+		}
+	}
+	_, ok := tx["Outputs"]
+	return !ok
+}
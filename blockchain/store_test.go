@@ -0,0 +1,378 @@
+package blockchain
+
+import (
+	"bytes"
+	bolt "go.etcd.io/bbolt"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+func testStores(t *testing.T, fn func(*testing.T, Store)) {
+	for _, backend := range []string{STORE_MEMORY, STORE_SQLITE, STORE_BOLT} {
+		t.Run(backend, func(t *testing.T) {
+			store, err := NewStore(backend, filepath.Join(t.TempDir(), "chain.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			fn(t, store)
+		})
+	}
+}
+
+func testBlock(id uint64) *Block {
+	tx := Transaction{
+		Version:   CHAIN_VERSION,
+		RandBytes: HashSum(append([]byte("tx"), ToBytes(id)...)),
+		Nonce:     id,
+		Sender:    "sender",
+		Outputs:   []Output{{Receiver: "receiver", Value: id}},
+		CurrHash:  testTxHash(id),
+	}
+	return &Block{
+		Version:      CHAIN_VERSION,
+		Difficulty:   DIFFICULTY,
+		CurrHash:     HashSum(append([]byte("block"), ToBytes(id)...)),
+		PrevHash:     HashSum(append([]byte("block"), ToBytes(id-1)...)),
+		Transactions: []Transaction{tx},
+		Mapping:      map[string]uint64{"receiver": id},
+		TimeStamp:    "2006-01-02T15:04:05Z",
+	}
+}
+
+func testTxHash(id uint64) []byte {
+	return HashSum(append([]byte("txhash"), ToBytes(id)...))
+}
+
+func testAppend(t *testing.T, store Store, count uint64) {
+	for id := store.Size() + 1; id <= count; id++ {
+		block := testBlock(id)
+		err := store.Append(id, block, big.NewInt(int64(id*100)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.AddTx(testTxHash(id), id, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.AddHistory("receiver", testTxHash(id), id); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.SetBalance("receiver", id, id*10, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStoreAppend(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		if store.Size() != 0 || store.Block(1) != nil || store.Work(1).Sign() != 0 {
+			t.Fatal("new store is not empty")
+		}
+		testAppend(t, store, 3)
+		if store.Size() != 3 {
+			t.Fatalf("size = %d, want 3", store.Size())
+		}
+		for id := uint64(1); id <= 3; id++ {
+			block := store.Block(id)
+			if block == nil || !bytes.Equal(EncodeBlock(block), EncodeBlock(testBlock(id))) {
+				t.Fatalf("block %d does not round trip", id)
+			}
+			if !bytes.Equal(store.Hash(id), testBlock(id).CurrHash) {
+				t.Fatalf("hash %d is not valid", id)
+			}
+			header := store.Header(id)
+			if header == nil || !bytes.Equal(EncodeHeader(header), EncodeHeader(testBlock(id).Header())) {
+				t.Fatalf("header %d does not round trip", id)
+			}
+			if store.Height(testBlock(id).CurrHash) != id {
+				t.Fatalf("height of block %d is not valid", id)
+			}
+			if store.Work(id).Cmp(big.NewInt(int64(id*100))) != 0 {
+				t.Fatalf("work %d = %s", id, store.Work(id))
+			}
+		}
+		if store.Block(4) != nil || store.Hash(4) != nil || store.Header(4) != nil || store.Height([]byte("unknown")) != 0 {
+			t.Fatal("unknown block found")
+		}
+		if store.Append(3, testBlock(4), big.NewInt(1)) == nil {
+			t.Fatal("existing block id accepted")
+		}
+		if store.Append(5, testBlock(5), big.NewInt(1)) == nil {
+			t.Fatal("block id gap accepted")
+		}
+		if store.Append(4, testBlock(3), big.NewInt(1)) == nil {
+			t.Fatal("duplicate block hash accepted")
+		}
+	})
+}
+
+func TestStoreIndex(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 3)
+		blockId, txId, ok := store.TxIndex(testTxHash(2))
+		if !ok || blockId != 2 || txId != 0 {
+			t.Fatalf("tx index = %d, %d, %v", blockId, txId, ok)
+		}
+		if _, _, ok = store.TxIndex([]byte("unknown")); ok {
+			t.Fatal("unknown tx found")
+		}
+		if store.AddTx(testTxHash(2), 3, 0) == nil {
+			t.Fatal("duplicate tx index accepted")
+		}
+		history := store.History("receiver", 2)
+		if len(history) != 2 || !bytes.Equal(history[0], testTxHash(3)) || !bytes.Equal(history[1], testTxHash(2)) {
+			t.Fatal("history is not newest first")
+		}
+		if len(store.History("unknown", HISTORY_LIMIT)) != 0 {
+			t.Fatal("unknown history found")
+		}
+		if err := store.ClearIndex(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok = store.TxIndex(testTxHash(2)); ok || len(store.History("receiver", HISTORY_LIMIT)) != 0 {
+			t.Fatal("index not cleared")
+		}
+		if balance, _ := store.Balance("receiver", 3); balance != 0 || store.Size() != 3 {
+			t.Fatal("clear index is not valid")
+		}
+	})
+}
+
+func TestStoreBalance(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 3)
+		if err := store.SetBalance("other", 2, 5, 1); err != nil {
+			t.Fatal(err)
+		}
+		for size, want := range map[uint64][2]uint64{0: {0, 0}, 1: {10, 1}, 2: {20, 2}, 5: {30, 3}} {
+			balance, nonce := store.Balance("receiver", size)
+			if balance != want[0] || nonce != want[1] {
+				t.Fatalf("balance at %d = %d, %d", size, balance, nonce)
+			}
+		}
+		if err := store.SetBalance("receiver", 3, 40, 4); err != nil {
+			t.Fatal(err)
+		}
+		if balance, nonce := store.Balance("receiver", 3); balance != 40 || nonce != 4 {
+			t.Fatal("balance not replaced")
+		}
+		if balance, nonce := store.Balance("unknown", 3); balance != 0 || nonce != 0 {
+			t.Fatal("unknown balance found")
+		}
+		for size, want := range map[uint64]uint64{0: 0, 1: 10, 2: 25, 3: 45} {
+			if supply := store.Supply(size); supply != want {
+				t.Fatalf("supply at %d = %d, want %d", size, supply, want)
+			}
+		}
+	})
+}
+
+func TestStoreTruncate(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 3)
+		if err := store.Truncate(1); err != nil {
+			t.Fatal(err)
+		}
+		if store.Size() != 1 || store.Block(2) != nil || store.Header(2) != nil || store.Hash(2) != nil || store.Work(2).Sign() != 0 {
+			t.Fatal("blocks not truncated")
+		}
+		if store.Height(testBlock(2).CurrHash) != 0 || store.Height(testBlock(1).CurrHash) != 1 {
+			t.Fatal("hashes not truncated")
+		}
+		if _, _, ok := store.TxIndex(testTxHash(2)); ok {
+			t.Fatal("tx index not truncated")
+		}
+		if _, _, ok := store.TxIndex(testTxHash(1)); !ok {
+			t.Fatal("tx index truncated too far")
+		}
+		if history := store.History("receiver", HISTORY_LIMIT); len(history) != 1 {
+			t.Fatalf("history length = %d, want 1", len(history))
+		}
+		if balance, _ := store.Balance("receiver", 3); balance != 10 {
+			t.Fatalf("balance = %d, want 10", balance)
+		}
+		testAppend(t, store, 3)
+		if store.Size() != 3 || store.Height(testBlock(3).CurrHash) != 3 {
+			t.Fatal("append after truncate is not valid")
+		}
+	})
+}
+
+func TestStorePool(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		if store.PoolSize() != 0 || len(store.PoolTransactions()) != 0 {
+			t.Fatal("new pool is not empty")
+		}
+		for id := uint64(1); id <= 3; id++ {
+			if err := store.PoolAdd(&testBlock(id).Transactions[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if store.PoolAdd(&testBlock(2).Transactions[0]) == nil {
+			t.Fatal("duplicate pool tx accepted")
+		}
+		if store.PoolSize() != 3 || !store.PoolContains(testTxHash(2)) || store.PoolContains(testTxHash(4)) {
+			t.Fatal("pool index is not valid")
+		}
+		txs := store.PoolTransactions()
+		for i, tx := range txs {
+			if !bytes.Equal(tx.CurrHash, testTxHash(uint64(i+1))) {
+				t.Fatal("pool order is not valid")
+			}
+		}
+		if err := store.PoolReset([]*Transaction{txs[2], txs[0]}); err != nil {
+			t.Fatal(err)
+		}
+		txs = store.PoolTransactions()
+		if store.PoolSize() != 2 || len(txs) != 2 || store.PoolContains(testTxHash(2)) {
+			t.Fatal("pool not reset")
+		}
+		if !bytes.Equal(txs[0].CurrHash, testTxHash(3)) || !bytes.Equal(txs[1].CurrHash, testTxHash(1)) {
+			t.Fatal("pool reset order is not valid")
+		}
+		if err := store.PoolAdd(&testBlock(2).Transactions[0]); err != nil {
+			t.Fatal(err)
+		}
+		if store.PoolSize() != 3 || !store.PoolContains(testTxHash(2)) {
+			t.Fatal("pool add after reset is not valid")
+		}
+	})
+}
+
+func TestStoreTransaction(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 1)
+		temp, err := store.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = temp.Begin(); err == nil {
+			t.Fatal("nested transaction accepted")
+		}
+		testAppend(t, temp, 2)
+		if err = temp.PoolAdd(&testBlock(3).Transactions[0]); err != nil {
+			t.Fatal(err)
+		}
+		if temp.Size() != 2 || temp.PoolSize() != 1 {
+			t.Fatal("transaction writes not visible")
+		}
+		if err = temp.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if store.Size() != 1 || store.Header(2) != nil || store.Height(testBlock(2).CurrHash) != 0 || store.PoolSize() != 0 {
+			t.Fatal("rollback is not valid")
+		}
+		if _, _, ok := store.TxIndex(testTxHash(2)); ok {
+			t.Fatal("rollback kept tx index")
+		}
+		temp, err = store.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testAppend(t, temp, 2)
+		if err = temp.PoolAdd(&testBlock(3).Transactions[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err = temp.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if store.Size() != 2 || store.Header(2) == nil || store.Height(testBlock(2).CurrHash) != 2 || !store.PoolContains(testTxHash(3)) {
+			t.Fatal("commit is not valid")
+		}
+		if balance, _ := store.Balance("receiver", 2); balance != 20 {
+			t.Fatalf("balance = %d, want 20", balance)
+		}
+		if store.Commit() == nil || store.Rollback() == nil {
+			t.Fatal("commit outside transaction accepted")
+		}
+	})
+}
+
+func TestStoreMigrate(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 2)
+		if err := store.PoolAdd(&testBlock(3).Transactions[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		if store.Size() != 2 || !bytes.Equal(EncodeBlock(store.Block(2)), EncodeBlock(testBlock(2))) {
+			t.Fatal("migrate changed blocks")
+		}
+		if store.PoolSize() != 1 || !store.PoolContains(testTxHash(3)) {
+			t.Fatal("migrate changed pool")
+		}
+	})
+}
+
+func TestMigrateBlock(t *testing.T) {
+	block := testBlock(1)
+	block.Version = LEGACY_VERSION
+	for i := range block.Transactions {
+		block.Transactions[i].Version = LEGACY_VERSION
+	}
+	data, err := migrateBlock([]byte(SerializeBlock(block)))
+	if err != nil || !bytes.Equal(data, EncodeBlock(block)) {
+		t.Fatal("json block not migrated")
+	}
+	if data, err = migrateBlock(EncodeBlock(block)); err != nil || !bytes.Equal(data, EncodeBlock(block)) {
+		t.Fatal("binary block changed")
+	}
+	for _, value := range []string{
+		`{"Nonce":1,"Difficulty":20,"CurrHash":"AQ==","PrevHash":"AQ==","Transactions":null,"Mapping":{},"Miner":"","Signature":null,"TimeStamp":""}`,
+		`{"MerkleRoot":"AQ==","Transactions":[{"RandBytes":"AQ==","PrevBlock":"AQ==","Sender":"a","Receiver":"b","Value":1,"ToStorage":0}]}`,
+		`{"MerkleRoot":"AQ==","Transactions":[{"RandBytes":"AQ==","Nonce":1,"Sender":"a","Receiver":"b","Value":1}]}`,
+	} {
+		if _, err = migrateBlock([]byte(value)); err == nil || err.Error() != "legacy JSON chain format is not supported" {
+			t.Fatalf("legacy JSON block accepted: %v", err)
+		}
+	}
+	if _, err = migrateTX([]byte(`{"RandBytes":"AQ==","Sender":"a","Receiver":"b","Value":1}`)); err == nil {
+		t.Fatal("legacy JSON tx accepted")
+	}
+	if _, err = migrateBlock([]byte("not a block")); err == nil {
+		t.Fatal("invalid block accepted")
+	}
+}
+
+func TestStoreMigrateHeader(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		testAppend(t, store, 2)
+		switch store := store.(type) {
+		case *SQLiteStore:
+			if _, err := store.DB.Exec("UPDATE BlockChain SET Header=NULL"); err != nil {
+				t.Fatal(err)
+			}
+		case *BoltStore:
+			err := store.update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(BUCKET_HEADERS)).Delete(ToBytes(2))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if header := store.Header(2); header == nil || !bytes.Equal(header.CurrHash, testBlock(2).CurrHash) {
+			t.Fatal("header not read from block")
+		}
+		if err := store.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		switch store := store.(type) {
+		case *SQLiteStore:
+			var count int
+			store.DB.QueryRow("SELECT COUNT(*) FROM BlockChain WHERE Header IS NULL").Scan(&count)
+			if count != 0 {
+				t.Fatalf("%d headers not migrated", count)
+			}
+		case *BoltStore:
+			store.view(func(tx *bolt.Tx) error {
+				if tx.Bucket([]byte(BUCKET_HEADERS)).Get(ToBytes(2)) == nil {
+					t.Fatal("header not migrated")
+				}
+				return nil
+			})
+		}
+	})
+}
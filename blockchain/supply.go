@@ -0,0 +1,20 @@
+package blockchain
+
+func Subsidy(size uint64) uint64 {
+	if size == 0 {
+		return 0
+	}
+	halvings := (size - 1) / HALVING_INTERVAL
+	if halvings >= 64 {
+		return 0
+	}
+	return INITIAL_SUBSIDY >> halvings
+}
+
+func MaxSupply() uint64 {
+	supply := uint64(GENESIS_REWARD)
+	for subsidy := uint64(INITIAL_SUBSIDY); subsidy > 0; subsidy >>= 1 {
+		supply += subsidy * HALVING_INTERVAL
+	}
+	return supply
+}
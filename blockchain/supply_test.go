@@ -0,0 +1,38 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestSubsidy(t *testing.T) {
+	tests := []struct {
+		size    uint64
+		subsidy uint64
+	}{
+		{0, 0},
+		{1, INITIAL_SUBSIDY},
+		{HALVING_INTERVAL, INITIAL_SUBSIDY},
+		{HALVING_INTERVAL + 1, INITIAL_SUBSIDY / 2},
+		{2 * HALVING_INTERVAL, INITIAL_SUBSIDY / 2},
+		{2*HALVING_INTERVAL + 1, INITIAL_SUBSIDY / 4},
+		{6 * HALVING_INTERVAL, INITIAL_SUBSIDY >> 5},
+		{6*HALVING_INTERVAL + 1, 0},
+		{64*HALVING_INTERVAL + 1, 0},
+		{1<<64 - 1, 0},
+	}
+	for _, test := range tests {
+		if subsidy := Subsidy(test.size); subsidy != test.subsidy {
+			t.Errorf("Subsidy(%d) = %d, want %d", test.size, subsidy, test.subsidy)
+		}
+	}
+}
+
+func TestMaxSupply(t *testing.T) {
+	supply := uint64(GENESIS_REWARD)
+	for size := uint64(1); Subsidy(size) > 0; size++ {
+		supply += Subsidy(size)
+	}
+	if supply != MaxSupply() {
+		t.Fatalf("MaxSupply = %d, want %d", MaxSupply(), supply)
+	}
+}
@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+func (chain *BlockChain) FindHeaders(size uint64, fetch func(start, count uint64) []*BlockHeader) (uint64, []*BlockHeader, error) {
+	var (
+		headers  []*BlockHeader
+		height   = size
+		ancestor = uint64(0)
+		found    = false
+	)
+	for height > 0 && !found {
+		count := uint64(HEADERS_LIMIT)
+		if count > height {
+			count = height
+		}
+		start := height - count
+		batch := fetch(start, count)
+		if uint64(len(batch)) != count {
+			return 0, nil, errors.New("fetch headers failed")
+		}
+		for i := len(batch) - 1; i >= 0; i-- {
+			id := start + uint64(i) + 1
+			if batch[i] != nil && id <= chain.Size() && bytes.Equal(batch[i].CurrHash, chain.Store.Hash(id)) {
+				ancestor, found = id, true
+				batch = batch[i+1:]
+				break
+			}
+		}
+		headers = append(batch, headers...)
+		height = start
+	}
+	if !found {
+		return 0, nil, errors.New("common ancestor not found")
+	}
+	if len(headers) == 0 {
+		return 0, nil, errors.New("fork is empty")
+	}
+	var (
+		prevHash = chain.Store.Hash(ancestor)
+		work     = big.NewInt(0)
+		lookup   = func(id uint64) *BlockHeader {
+			if id > ancestor {
+				return headers[id-ancestor-1]
+			}
+			return chain.Header(id)
+		}
+	)
+	for i, header := range headers {
+		id := ancestor + uint64(i) + 1
+		difficulty, _ := retarget(id-1, lookup)
+		if !header.IsValid(prevHash, chain.Version(id), difficulty) {
+			return 0, nil, errors.New("header in fork is not valid")
+		}
+		work.Add(work, header.Work())
+		prevHash = header.CurrHash
+	}
+	if work.Cmp(new(big.Int).Sub(chain.Work(), chain.Store.Work(ancestor))) <= 0 {
+		return 0, nil, errors.New("fork work <= chain work")
+	}
+	return ancestor, headers, nil
+}
+
+func VerifyHeaders(headers []*BlockHeader) error {
+	if len(headers) == 0 {
+		return errors.New("headers is empty")
+	}
+	genesis := headers[0]
+	switch {
+	case genesis == nil:
+		return errors.New("genesis is null")
+	case genesis.Version != LEGACY_VERSION && genesis.Version != CHAIN_VERSION:
+		return errors.New("genesis version is not valid")
+	case !bytes.Equal(genesis.PrevHash, []byte(GENESIS_BLOCK)):
+		return errors.New("genesis prev hash is not valid")
+	case !bytes.Equal(genesis.hash(), genesis.CurrHash):
+		return errors.New("genesis hash is not valid")
+	}
+	var (
+		chain  = &BlockChain{activation: activationHeight(genesis)}
+		lookup = func(id uint64) *BlockHeader {
+			if id == 0 || id > uint64(len(headers)) {
+				return nil
+			}
+			return headers[id-1]
+		}
+	)
+	for i := 1; i < len(headers); i++ {
+		id := uint64(i) + 1
+		difficulty, ok := retarget(id-1, lookup)
+		if !ok || !headers[i].IsValid(headers[i-1].CurrHash, chain.Version(id), difficulty) {
+			return errors.New("header is not valid")
+		}
+	}
+	return nil
+}
+
+func FetchBodies(height uint64, headers []*BlockHeader, peers int, fetch func(peer int, start, count uint64) []*Block) ([]*Block, error) {
+	if peers <= 0 {
+		return nil, errors.New("peers is empty")
+	}
+	var (
+		blocks = make([]*Block, len(headers))
+		group  sync.WaitGroup
+		jobs   = make(chan int)
+	)
+	for peer := 0; peer < peers; peer++ {
+		group.Add(1)
+		go func(peer int) {
+			defer group.Done()
+			for lo := range jobs {
+				hi := lo + BLOCKS_LIMIT
+				if hi > len(headers) {
+					hi = len(headers)
+				}
+				for try := 0; lo < hi && try < peers; {
+					batch := fetch((peer+try)%peers, height+uint64(lo), uint64(hi-lo))
+					n := 0
+					for n < len(batch) && lo+n < hi && headers[lo+n].Matches(batch[n]) {
+						blocks[lo+n] = batch[n]
+						n++
+					}
+					if n == 0 {
+						try++
+					}
+					lo += n
+				}
+			}
+		}(peer)
+	}
+	for lo := 0; lo < len(headers); lo += BLOCKS_LIMIT {
+		jobs <- lo
+	}
+	close(jobs)
+	group.Wait()
+	for _, block := range blocks {
+		if block == nil {
+			return nil, errors.New("fetch block failed")
+		}
+	}
+	return blocks, nil
+}
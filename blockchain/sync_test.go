@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func testMine(t *testing.T, chain *BlockChain, user *User, count int) {
+	for i := 0; i < count; i++ {
+		time.Sleep(1100 * time.Millisecond)
+		block := NewBlock(user.Address(), chain.LastHash(), chain.Difficulty(chain.Size()))
+		if err := block.Accept(chain, user, make(chan bool)); err != nil {
+			t.Fatal(err)
+		}
+		if !block.IsValid(chain, chain.Size()) {
+			t.Fatal("mined block is not valid")
+		}
+		if err := chain.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testHeaders(chain *BlockChain) []*BlockHeader {
+	var headers []*BlockHeader
+	for id := uint64(1); id <= chain.Size(); id++ {
+		headers = append(headers, chain.Header(id))
+	}
+	return headers
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	user := NewUserScheme(SCHEME_ED25519)
+	chain := testChain(t, user.Address())
+	testMine(t, chain, user, 2)
+	tests := []struct {
+		name   string
+		change func(headers []*BlockHeader) []*BlockHeader
+		valid  bool
+	}{
+		{"chain", func(headers []*BlockHeader) []*BlockHeader { return headers }, true},
+		{"genesis", func(headers []*BlockHeader) []*BlockHeader { return headers[:1] }, true},
+		{"empty", func(headers []*BlockHeader) []*BlockHeader { return nil }, false},
+		{"without genesis", func(headers []*BlockHeader) []*BlockHeader { return headers[1:] }, false},
+		{"order", func(headers []*BlockHeader) []*BlockHeader {
+			return []*BlockHeader{headers[0], headers[2], headers[1]}
+		}, false},
+		{"miner", func(headers []*BlockHeader) []*BlockHeader {
+			headers[2].Miner = "miner"
+			return headers
+		}, false},
+		{"zero difficulty", func(headers []*BlockHeader) []*BlockHeader {
+			headers[2].Difficulty = 0
+			headers[2].CurrHash = headers[2].hash()
+			return headers
+		}, false},
+		{"version", func(headers []*BlockHeader) []*BlockHeader {
+			headers[2].Version = LEGACY_VERSION
+			headers[2].CurrHash = headers[2].hash()
+			return headers
+		}, false},
+		{"genesis prev hash", func(headers []*BlockHeader) []*BlockHeader {
+			headers[0].PrevHash = []byte("prev")
+			headers[0].CurrHash = headers[0].hash()
+			return headers
+		}, false},
+		{"null", func(headers []*BlockHeader) []*BlockHeader {
+			headers[1] = nil
+			return headers
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyHeaders(test.change(testHeaders(chain)))
+			if (err == nil) != test.valid {
+				t.Fatalf("VerifyHeaders = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
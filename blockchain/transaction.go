@@ -2,47 +2,146 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"crypto"
+	"time"
 )
 
-func NewTransaction(user *User, lasthash []byte, to string, value uint64) *Transaction {
+func NewTransaction(user *User, genesis []byte, version uint8, nonce uint64, to string, value, fee uint64) *Transaction {
+	return NewLockedTransaction(user, genesis, version, nonce, to, value, fee, 0)
+}
+
+func NewLockedTransaction(user *User, genesis []byte, version uint8, nonce uint64, to string, value, fee, lock uint64) *Transaction {
+	return NewBatchTransaction(user, genesis, version, nonce, []Output{{Receiver: to, Value: value}}, fee, lock)
+}
+
+func NewBatchTransaction(user *User, genesis []byte, version uint8, nonce uint64, outputs []Output, fee, lock uint64) *Transaction {
 	tx := &Transaction{
+		Version:   version,
 		RandBytes: GenerateRandomBytes(RAND_BYTES),
-		PrevBlock: lasthash,
+		Nonce:     nonce,
 		Sender:    user.Address(),
-		Receiver:  to,
-		Value:     value,
+		PublicKey: user.PublicKey(),
+		Outputs:   outputs,
+		Fee:       fee,
+		Lock:      lock,
 	}
-	if value > START_PERCENT {
-		tx.ToStorage = STORAGE_REWARD
+	tx.CurrHash = tx.hash(genesis)
+	tx.Signature = tx.sign(user.Private())
+	return tx
+}
+
+func NewLegacyTransaction(user *User, genesis []byte, version uint8, nonce uint64, outputs []Output, fee uint64) *Transaction {
+	tx := &Transaction{
+		Version:   version,
+		RandBytes: GenerateRandomBytes(RAND_BYTES),
+		Nonce:     nonce,
+		Sender:    user.PublicKey(),
+		Outputs:   outputs,
+		Fee:       fee,
 	}
-	tx.CurrHash = tx.hash()
+	tx.CurrHash = tx.hash(genesis)
 	tx.Signature = tx.sign(user.Private())
 	return tx
 }
 
-func (tx *Transaction) hash() []byte {
+func (tx *Transaction) Total() (uint64, bool) {
+	var total uint64
+	for _, out := range tx.Outputs {
+		if total+out.Value < total {
+			return 0, false
+		}
+		total += out.Value
+	}
+	return total, true
+}
+
+func (tx *Transaction) size() int {
+	size := len(EncodeTX(tx)) + 1 + len(tx.Sender) + 2*MAPPING_ENTRY
+	for _, out := range tx.Outputs {
+		size += len(out.Receiver) + MAPPING_ENTRY
+	}
+	return size
+}
+
+func (tx *Transaction) hasReceiver(address string) bool {
+	for _, out := range tx.Outputs {
+		if out.Receiver == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *Transaction) hash(genesis []byte) []byte {
+	if tx.Version == LEGACY_VERSION {
+		return tx.legacyHash()
+	}
+	fields := [][]byte{
+		genesis,
+		{tx.Version},
+		tx.RandBytes,
+		ToBytes(tx.Nonce),
+		[]byte(tx.Sender),
+		[]byte(tx.PublicKey),
+		ToBytes(uint64(len(tx.Outputs))),
+	}
+	for _, out := range tx.Outputs {
+		fields = append(fields, []byte(out.Receiver), ToBytes(out.Value))
+	}
+	fields = append(fields, ToBytes(tx.Fee), ToBytes(tx.Lock))
+	return CanonicalHash(TAG_TRANSACTION, fields...)
+}
+
+func (tx *Transaction) legacyHash() []byte {
+	var tempHash []byte
+	for _, out := range tx.Outputs {
+		tempHash = HashSum(bytes.Join(
+			[][]byte{
+				tempHash,
+				[]byte(out.Receiver),
+				ToBytes(out.Value),
+			},
+			[]byte{},
+		))
+	}
 	return HashSum(bytes.Join(
 		[][]byte{
 			tx.RandBytes,
-			tx.PrevBlock,
+			ToBytes(tx.Nonce),
 			[]byte(tx.Sender),
-			[]byte(tx.Receiver),
-			ToBytes(tx.Value),
-			ToBytes(tx.ToStorage),
+			[]byte(tx.PublicKey),
+			tempHash,
+			ToBytes(tx.Fee),
+			ToBytes(tx.Lock),
 		},
 		[]byte{},
 	))
 }
 
-func (tx *Transaction) sign(priv *rsa.PrivateKey) []byte {
+func (tx *Transaction) sign(priv crypto.PrivateKey) []byte {
 	return Sign(priv, tx.CurrHash)
 }
 
-func (tx *Transaction) hashIsValid() bool {
-	return bytes.Equal(tx.hash(), tx.CurrHash)
+func (tx *Transaction) IsFinal(height uint64, btime time.Time) bool {
+	if tx.Lock < LOCK_THRESHOLD {
+		return tx.Lock <= height
+	}
+	return tx.Lock <= uint64(btime.Unix())
+}
+
+func (tx *Transaction) hashIsValid(genesis []byte) bool {
+	return bytes.Equal(tx.hash(genesis), tx.CurrHash)
 }
 
 func (tx *Transaction) signIsValid() bool {
-	return Verify(ParsePublic(tx.Sender), tx.CurrHash, tx.Signature) == nil
+	if tx.PublicKey == "" {
+		return Verify(ParsePublic(tx.Sender), tx.CurrHash, tx.Signature) == nil
+	}
+	if PublicToAddress(tx.PublicKey) != tx.Sender {
+		return false
+	}
+	if ms := ParseMultisig(tx.PublicKey); ms != nil {
+		return ms.verify(tx.CurrHash, tx.Signatures)
+	}
+	return Verify(ParsePublic(tx.PublicKey), tx.CurrHash, tx.Signature) == nil
 }
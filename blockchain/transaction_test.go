@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTransactionGenesis(t *testing.T) {
+	var (
+		user  = NewUserScheme(SCHEME_ED25519)
+		main  = HashSum([]byte("main"))
+		other = HashSum([]byte("other"))
+	)
+	tests := []struct {
+		name    string
+		tx      *Transaction
+		genesis []byte
+		valid   bool
+	}{
+		{"same chain", NewTransaction(user, main, CHAIN_VERSION, 0, "receiver", 1, 0), main, true},
+		{"other chain", NewTransaction(user, main, CHAIN_VERSION, 0, "receiver", 1, 0), other, false},
+		{"no genesis", NewTransaction(user, main, CHAIN_VERSION, 0, "receiver", 1, 0), nil, false},
+		{"legacy", NewTransaction(user, main, LEGACY_VERSION, 0, "receiver", 1, 0), other, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := test.tx.hashIsValid(test.genesis); valid != test.valid {
+				t.Fatalf("hashIsValid = %v, want %v", valid, test.valid)
+			}
+			if !test.tx.signIsValid() {
+				t.Fatal("sign is not valid")
+			}
+		})
+	}
+}
+
+func TestTransactionIsFinal(t *testing.T) {
+	btime := time.Unix(LOCK_THRESHOLD+100, 0)
+	tests := []struct {
+		name  string
+		lock  uint64
+		final bool
+	}{
+		{"no lock", 0, true},
+		{"height passed", 9, true},
+		{"height reached", 10, true},
+		{"height locked", 11, false},
+		{"last height", LOCK_THRESHOLD - 1, false},
+		{"time passed", LOCK_THRESHOLD, true},
+		{"time reached", LOCK_THRESHOLD + 100, true},
+		{"time locked", LOCK_THRESHOLD + 101, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := &Transaction{Lock: test.lock}
+			if final := tx.IsFinal(10, btime); final != test.final {
+				t.Fatalf("IsFinal = %v, want %v", final, test.final)
+			}
+		})
+	}
+}
+
+func TestTransactionTotal(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []uint64
+		total  uint64
+		ok     bool
+	}{
+		{"none", nil, 0, true},
+		{"single", []uint64{5}, 5, true},
+		{"outputs", []uint64{1, 2, 3}, 6, true},
+		{"max", []uint64{math.MaxUint64 - 1, 1}, math.MaxUint64, true},
+		{"overflow", []uint64{math.MaxUint64, 1}, 0, false},
+		{"overflow later", []uint64{1, math.MaxUint64 - 1, 1}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := &Transaction{}
+			for _, value := range test.values {
+				tx.Outputs = append(tx.Outputs, Output{Receiver: "receiver", Value: value})
+			}
+			if total, ok := tx.Total(); total != test.total || ok != test.ok {
+				t.Fatalf("Total = %d %v, want %d %v", total, ok, test.total, test.ok)
+			}
+		})
+	}
+}
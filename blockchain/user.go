@@ -1,16 +1,24 @@
 package blockchain
 
 import (
-	"crypto/rsa"
+	"crypto"
 )
 
 type User struct {
-	PrivateKey *rsa.PrivateKey
+	PrivateKey crypto.Signer
 }
 
 func NewUser() *User {
+	return NewUserScheme(DEFAULT_SCHEME)
+}
+
+func NewUserScheme(scheme string) *User {
+	priv := GenerateKey(scheme)
+	if priv == nil {
+		return nil
+	}
 	return &User{
-		PrivateKey: GeneratePrivate(KEY_SIZE),
+		PrivateKey: priv,
 	}
 }
 
@@ -25,6 +33,10 @@ func LoadUser(purse string) *User {
 }
 
 func (user *User) Address() string {
+	return PublicToAddress(user.PublicKey())
+}
+
+func (user *User) PublicKey() string {
 	return StringPublic(user.Public())
 }
 
@@ -32,10 +44,10 @@ func (user *User) Purse() string {
 	return StringPrivate(user.Private())
 }
 
-func (user *User) Private() *rsa.PrivateKey {
+func (user *User) Private() crypto.Signer {
 	return user.PrivateKey
 }
 
-func (user *User) Public() *rsa.PublicKey {
-	return &(user.PrivateKey).PublicKey
+func (user *User) Public() crypto.PublicKey {
+	return user.PrivateKey.Public()
 }
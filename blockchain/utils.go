@@ -37,3 +37,60 @@ func DeserializeTX(data string) *Transaction {
 	}
 	return &tx
 }
+
+func PackBlock(block *Block) string {
+	return Base64Encode(EncodeBlock(block))
+}
+
+func UnpackBlock(data string) *Block {
+	return DecodeBlock(Base64Decode(data))
+}
+
+func PackTX(tx *Transaction) string {
+	return Base64Encode(EncodeTX(tx))
+}
+
+func UnpackTX(data string) *Transaction {
+	return DecodeTX(Base64Decode(data))
+}
+
+func PackHeader(header *BlockHeader) string {
+	return Base64Encode(EncodeHeader(header))
+}
+
+func UnpackHeader(data string) *BlockHeader {
+	return DecodeHeader(Base64Decode(data))
+}
+
+func SerializeProof(proof *Proof) string {
+	jsonData, err := json.MarshalIndent(*proof, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(jsonData)
+}
+
+func DeserializeProof(data string) *Proof {
+	var proof Proof
+	err := json.Unmarshal([]byte(data), &proof)
+	if err != nil {
+		return nil
+	}
+	return &proof
+}
+
+func SerializeTxInfo(info *TxInfo) string {
+	jsonData, err := json.MarshalIndent(*info, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(jsonData)
+}
+
+func SerializeHistory(history []TxInfo) string {
+	jsonData, err := json.MarshalIndent(history, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(jsonData)
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/tyler-smith/go-bip39"
+)
+
+func NewWallet() *Wallet {
+	entropy, err := bip39.NewEntropy(MNEMONIC_BITS)
+	if err != nil {
+		return nil
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil
+	}
+	return &Wallet{
+		Mnemonic: mnemonic,
+		Size:     1,
+	}
+}
+
+func LoadWallet(mnemonic string, size uint32) *Wallet {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil
+	}
+	if size == 0 {
+		size = 1
+	}
+	return &Wallet{
+		Mnemonic: mnemonic,
+		Size:     size,
+	}
+}
+
+func EncryptWallet(wallet *Wallet, pass string) string {
+	jsonData, err := json.Marshal(wallet)
+	if err != nil {
+		return ""
+	}
+	return sealKeystore(KEYSTORE_WALLET, wallet.User(0).Address(), jsonData, pass)
+}
+
+func DecryptWallet(data, pass string) *Wallet {
+	keystore, payload := openKeystore(KEYSTORE_WALLET, data, pass)
+	if keystore == nil {
+		return nil
+	}
+	var wallet Wallet
+	err := json.Unmarshal(payload, &wallet)
+	if err != nil {
+		return nil
+	}
+	return LoadWallet(wallet.Mnemonic, wallet.Size)
+}
+
+func (wallet *Wallet) Derive() *User {
+	wallet.Size++
+	return wallet.User(wallet.Size - 1)
+}
+
+func (wallet *Wallet) Users() []*User {
+	var users []*User
+	for i := uint32(0); i < wallet.Size; i++ {
+		users = append(users, wallet.User(i))
+	}
+	return users
+}
+
+func (wallet *Wallet) User(index uint32) *User {
+	if wallet.seed == nil {
+		wallet.seed = bip39.NewSeed(wallet.Mnemonic, "")
+	}
+	key, chainCode := hdMaster(wallet.seed)
+	for _, i := range []uint32{HD_PURPOSE, HD_COIN, index} {
+		key, chainCode = hdChild(key, chainCode, i)
+	}
+	return &User{
+		PrivateKey: ed25519.NewKeyFromSeed(key),
+	}
+}
+
+func hdMaster(seed []byte) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, []byte(HD_SEED_KEY))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+func hdChild(key, chainCode []byte, index uint32) ([]byte, []byte) {
+	var data = make([]byte, 1+len(key)+4)
+	copy(data[1:], key)
+	binary.BigEndian.PutUint32(data[1+len(key):], index|HD_HARDENED)
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
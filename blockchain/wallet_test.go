@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestWalletSLIP10(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path      []uint32
+		key       string
+		chainCode string
+	}{
+		{
+			path:      nil,
+			key:       "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7",
+			chainCode: "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+		},
+		{
+			path:      []uint32{0},
+			key:       "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3",
+			chainCode: "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+		},
+		{
+			path:      []uint32{0, 1},
+			key:       "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2",
+			chainCode: "a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14",
+		},
+		{
+			path:      []uint32{0, 1, 2},
+			key:       "92a5b23c0b8a99e37d07df3fb9966917f5d06e02ddbd909c7e184371463e9fc9",
+			chainCode: "2e69929e00b5ab250f49c3fb1c12f252de4fed2c1db88387094a0f8c4c9ccd6c",
+		},
+	}
+	for _, test := range tests {
+		key, chainCode := hdMaster(seed)
+		for _, index := range test.path {
+			key, chainCode = hdChild(key, chainCode, index)
+		}
+		if hex.EncodeToString(key) != test.key || hex.EncodeToString(chainCode) != test.chainCode {
+			t.Errorf("path %v = %x %x, want %s %s", test.path, key, chainCode, test.key, test.chainCode)
+		}
+	}
+}
+
+func TestLoadWallet(t *testing.T) {
+	wallet := NewWallet()
+	tests := []struct {
+		name     string
+		mnemonic string
+		size     uint32
+		valid    bool
+	}{
+		{"wallet", wallet.Mnemonic, 3, true},
+		{"zero size", wallet.Mnemonic, 0, true},
+		{"invalid", "mnemonic", 1, false},
+		{"checksum", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loaded := LoadWallet(test.mnemonic, test.size)
+			if (loaded != nil) != test.valid {
+				t.Fatalf("LoadWallet = %v, want valid %v", loaded, test.valid)
+			}
+			if loaded == nil {
+				return
+			}
+			if loaded.Size == 0 || len(loaded.Users()) != int(loaded.Size) {
+				t.Fatal("wallet size is not valid")
+			}
+			if loaded.User(0).Address() != wallet.User(0).Address() {
+				t.Fatal("wallet derives other users")
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	bc "./blockchain"
 	nt "./network"
 	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -16,14 +18,21 @@ func init() {
 		panic("failed: len(os.Args) < 2")
 	}
 	var (
-		addrStr     = ""
-		userNewStr  = ""
-		userLoadStr = ""
+		addrStr        = ""
+		userNewStr     = ""
+		userLoadStr    = ""
+		userMigrateStr = ""
+		walletNewStr   = ""
+		walletLoadStr  = ""
+		schemeStr      = bc.DEFAULT_SCHEME
 	)
 	var (
-		addrExist     = false
-		userNewExist  = false
-		userLoadExist = false
+		addrExist        = false
+		userNewExist     = false
+		userLoadExist    = false
+		userMigrateExist = false
+		walletNewExist   = false
+		walletLoadExist  = false
 	)
 	for i := 1; i < len(os.Args); i++ {
 		arg := os.Args[i]
@@ -37,11 +46,24 @@ func init() {
 		case strings.HasPrefix(arg, "-loaduser:"):
 			userLoadStr = strings.Replace(arg, "-loaduser:", "", 1)
 			userLoadExist = true
+		case strings.HasPrefix(arg, "-migrateuser:"):
+			userMigrateStr = strings.Replace(arg, "-migrateuser:", "", 1)
+			userMigrateExist = true
+		case strings.HasPrefix(arg, "-newwallet:"):
+			walletNewStr = strings.Replace(arg, "-newwallet:", "", 1)
+			walletNewExist = true
+		case strings.HasPrefix(arg, "-loadwallet:"):
+			walletLoadStr = strings.Replace(arg, "-loadwallet:", "", 1)
+			walletLoadExist = true
+		case strings.HasPrefix(arg, "-scheme:"):
+			schemeStr = strings.Replace(arg, "-scheme:", "", 1)
 		}
 	}
 
-	if !(userNewExist || userLoadExist) || !addrExist {
-		panic("failed: !(userNewExist || userLoadExist) || !addrExist")
+	if !(userNewExist || userLoadExist || userMigrateExist || walletNewExist || walletLoadExist) ||
+		!addrExist {
+		panic("failed: !(userNewExist || userLoadExist || userMigrateExist" +
+			"|| walletNewExist || walletLoadExist) || !addrExist")
 	}
 
 	err := json.Unmarshal([]byte(readFile(addrStr)), &Addresses)
@@ -53,11 +75,28 @@ func init() {
 	}
 
 	if userNewExist {
-		User = userNew(userNewStr)
+		User = userNew(userNewStr, schemeStr)
 	}
 	if userLoadExist {
 		User = userLoad(userLoadStr)
 	}
+	if userMigrateExist {
+		User = userMigrate(userMigrateStr)
+	}
+	if walletNewExist {
+		WalletFile = walletNewStr
+		Wallet = walletNew(walletNewStr)
+	}
+	if walletLoadExist {
+		WalletFile = walletLoadStr
+		Wallet = walletLoad(walletLoadStr)
+	}
+	if (walletNewExist || walletLoadExist) && Wallet == nil {
+		panic("failed: load wallet")
+	}
+	if Wallet != nil {
+		User = Wallet.User(0)
+	}
 	if User == nil {
 		panic("failed: load user")
 	}
@@ -88,10 +127,54 @@ func handleClient() {
 				userAddress()
 			case "purse":
 				userPurse()
+			case "public":
+				userPublic()
 			case "balance":
 				userBalance()
+			case "history":
+				userHistory()
+			default:
+				fmt.Println("command undefined\n")
+			}
+		case "/multisig":
+			if len(splited) < 2 {
+				fmt.Println("failed: len(multisig) < 2\n")
+				continue
+			}
+			switch splited[1] {
+			case "create":
+				multisigCreate(splited[1:])
+			case "tx":
+				multisigTX(splited[1:])
+			case "sign":
+				multisigSign(splited[1:])
+			case "send":
+				multisigSend(splited[1:])
+			default:
+				fmt.Println("command undefined\n")
+			}
+		case "/wallet":
+			if len(splited) < 2 {
+				fmt.Println("failed: len(wallet) < 2\n")
+				continue
+			}
+			if Wallet == nil {
+				fmt.Println("failed: wallet is not loaded\n")
+				continue
+			}
+			switch splited[1] {
+			case "list":
+				walletList()
+			case "derive":
+				walletDerive()
+			case "balance":
+				walletBalance()
+			case "use":
+				walletUse(splited[1:])
+			case "mnemonic":
+				walletMnemonic()
 			default:
-    			fmt.Println("command undefined\n")
+				fmt.Println("command undefined\n")
 			}
 		case "/chain":
 			if len(splited) < 2 {
@@ -103,14 +186,24 @@ func handleClient() {
 				chainPrint()
 			case "tx":
 				chainTX(splited[1:])
+			case "batch":
+				chainBatch(splited[1:])
 			case "balance":
 				chainBalance(splited[1:])
 			case "block":
 				chainBlock(splited[1:])
 			case "size":
 				chainSize()
+			case "proof":
+				chainProof(splited[1:])
+			case "tx-info":
+				chainTxInfo(splited[1:])
+			case "supply":
+				chainSupply(splited[1:])
+			case "sweep":
+				chainSweep(splited[1:])
 			default:
-    			fmt.Println("command undefined\n")
+				fmt.Println("command undefined\n")
 			}
 		default:
 			fmt.Println("command undefined\n")
@@ -147,53 +240,312 @@ func chainBlock(splited []string) {
 		fmt.Println("failed: getBlock\n")
 		return
 	}
-	fmt.Printf("[%d] => %s\n", num, res.Data)
-} 
+	block := bc.UnpackBlock(res.Data)
+	if block == nil {
+		fmt.Println("failed: unpack block\n")
+		return
+	}
+	fmt.Printf("[%d] => %s\n", num, bc.SerializeBlock(block))
+}
 
-func chainPrint() {
-	for i := 0; ; i++ {
-		res := nt.Send(Addresses[0], &nt.Package{
+func chainProof(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	res := nt.Send(Addresses[0], &nt.Package{
+		Option: GET_PROOF,
+		Data:   splited[1],
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getProof\n")
+		return
+	}
+	proof := bc.DeserializeProof(res.Data)
+	if proof == nil || !proof.IsValid() {
+		fmt.Println("failed: proof is not valid\n")
+		return
+	}
+	res = nt.Send(Addresses[0], &nt.Package{
+		Option: GET_CSIZE,
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getSize\n")
+		return
+	}
+	size, err := strconv.ParseUint(res.Data, 10, 64)
+	if err != nil || proof.Height == 0 || proof.Height > size {
+		fmt.Println("failed: proof height is not valid\n")
+		return
+	}
+	headers, err := fetchHeaders(Addresses[0], 0, size)
+	if err != nil || uint64(len(headers)) != size {
+		fmt.Println("failed: getHeaders\n")
+		return
+	}
+	if bc.VerifyHeaders(headers) != nil {
+		fmt.Println("failed: headers are not valid\n")
+		return
+	}
+	res = nt.Send(Addresses[0], &nt.Package{
+		Option: GET_LHASH,
+	})
+	if res == nil || !bytes.Equal(bc.Base64Decode(res.Data), headers[len(headers)-1].CurrHash) {
+		fmt.Println("failed: last hash /= hash of headers\n")
+		return
+	}
+	confirmed := false
+	for _, addr := range Addresses[1:] {
+		tip, err := fetchHeaders(addr, size-1, 1)
+		if err == nil && len(tip) == 1 && bytes.Equal(tip[0].CurrHash, headers[size-1].CurrHash) {
+			confirmed = true
+			break
+		}
+	}
+	if !confirmed {
+		fmt.Println("failed: last hash is not confirmed by other nodes\n")
+		return
+	}
+	header := headers[proof.Height-1]
+	root := header.MerkleRoot
+	if header.Version == bc.LEGACY_VERSION {
+		res = nt.Send(Addresses[0], &nt.Package{
 			Option: GET_BLOCK,
-			Data:   fmt.Sprintf("%d", i),
+			Data:   fmt.Sprintf("%d", proof.Height-1),
 		})
 		if res == nil || res.Data == "" {
+			fmt.Println("failed: getBlock\n")
+			return
+		}
+		block := bc.UnpackBlock(res.Data)
+		if !header.Matches(block) {
+			fmt.Println("failed: block /= header\n")
+			return
+		}
+		root = block.MerkleRoot
+	}
+	if !bytes.Equal(root, proof.MerkleRoot) {
+		fmt.Println("failed: merkle root /= root in block\n")
+		return
+	}
+	fmt.Printf("Proof: tx included in block [%d] at index %d\n\n", proof.Height, proof.Index)
+}
+
+func chainTxInfo(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	res := nt.Send(Addresses[0], &nt.Package{
+		Option: GET_TRNSX,
+		Data:   splited[1],
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getTransaction\n")
+		return
+	}
+	fmt.Printf("TX => %s\n\n", res.Data)
+}
+
+func chainSupply(splited []string) {
+	if len(splited) > 2 {
+		fmt.Println("failed: len(splited) > 2\n")
+		return
+	}
+	var height string
+	if len(splited) == 2 {
+		height = splited[1]
+	}
+	res := nt.Send(Addresses[0], &nt.Package{
+		Option: GET_SUPLY,
+		Data:   height,
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getSupply\n")
+		return
+	}
+	fmt.Printf("Supply: %s/%d coins\n\n", res.Data, bc.MaxSupply())
+}
+
+func chainPrint() {
+	for i := 0; ; {
+		blocks, err := fetchBlocks(Addresses[0], uint64(i), bc.BLOCKS_LIMIT)
+		for _, block := range blocks {
+			i++
+			fmt.Printf("[%d] => %s\n", i, bc.SerializeBlock(block))
+		}
+		if err != nil {
+			fmt.Printf("failed: %s\n\n", err)
+			return
+		}
+		if len(blocks) == 0 {
 			break
 		}
-		fmt.Printf("[%d] => %s\n", i+1, res.Data)
 	}
 	fmt.Println()
 }
 
 func chainTX(splited []string) {
-	if len(splited) != 3 {
-		fmt.Println("failed: len(splited) != 3\n")
+	if len(splited) != 4 && len(splited) != 5 {
+		fmt.Println("failed: len(splited) != 4 && len(splited) != 5\n")
 		return
 	}
+	lock := 0
+	if len(splited) == 5 {
+		num, err := strconv.Atoi(splited[4])
+		if err != nil {
+			fmt.Println("failed: strconv.Atoi(lock)\n")
+			return
+		}
+		lock = num
+	}
 	num, err := strconv.Atoi(splited[2])
 	if err != nil {
 		fmt.Println("failed: strconv.Atoi(num)\n")
 		return
 	}
+	fee, err := strconv.Atoi(splited[3])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(fee)\n")
+		return
+	}
+	if !bc.AddressIsValid(splited[1]) {
+		fmt.Println("failed: address is not valid\n")
+		return
+	}
+	for _, addr := range Addresses {
+		nonce, version, err := fetchNonce(addr, User.Address())
+		if err != nil {
+			continue
+		}
+		genesis, err := fetchGenesis(addr)
+		if err != nil {
+			continue
+		}
+		tx := bc.NewLockedTransaction(User, genesis, version, nonce, splited[1], uint64(num), uint64(fee), uint64(lock))
+		res := nt.Send(addr, &nt.Package{
+			Option: ADD_TRNSX,
+			Data:   bc.PackTX(tx),
+		})
+		if res == nil {
+			continue
+		}
+		if res.Data == "ok" {
+			fmt.Printf("ok: (%s)\n", addr)
+			break
+		}
+		fmt.Printf("fail: (%s)\n", addr)
+	}
+	fmt.Println()
+}
+
+func chainBatch(splited []string) {
+	if len(splited) != 3 {
+		fmt.Println("failed: len(splited) != 3\n")
+		return
+	}
+	fee, err := strconv.Atoi(splited[2])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(fee)\n")
+		return
+	}
+	records, err := csv.NewReader(strings.NewReader(readFile(splited[1]))).ReadAll()
+	if err != nil || len(records) == 0 || len(records) > bc.OUTPUTS_LIMIT {
+		fmt.Println("failed: read csv\n")
+		return
+	}
+	var outputs []bc.Output
+	for i, record := range records {
+		if len(record) != 2 || !bc.AddressIsValid(strings.TrimSpace(record[0])) {
+			fmt.Printf("failed: record [%d] is not valid\n\n", i+1)
+			return
+		}
+		num, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 64)
+		if err != nil {
+			fmt.Printf("failed: record [%d] value is not valid\n\n", i+1)
+			return
+		}
+		outputs = append(outputs, bc.Output{
+			Receiver: strings.TrimSpace(record[0]),
+			Value:    num,
+		})
+	}
+	for _, addr := range Addresses {
+		nonce, version, err := fetchNonce(addr, User.Address())
+		if err != nil {
+			continue
+		}
+		genesis, err := fetchGenesis(addr)
+		if err != nil {
+			continue
+		}
+		tx := bc.NewBatchTransaction(User, genesis, version, nonce, outputs, uint64(fee), 0)
+		res := nt.Send(addr, &nt.Package{
+			Option: ADD_TRNSX,
+			Data:   bc.PackTX(tx),
+		})
+		if res == nil {
+			continue
+		}
+		if res.Data == "ok" {
+			fmt.Printf("ok: (%s)\n", addr)
+			break
+		}
+		fmt.Printf("fail: (%s)\n", addr)
+	}
+	fmt.Println()
+}
+
+func chainSweep(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	fee, err := strconv.Atoi(splited[1])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(fee)\n")
+		return
+	}
 	for _, addr := range Addresses {
 		res := nt.Send(addr, &nt.Package{
-			Option: GET_LHASH,
+			Option: GET_BLNCE,
+			Data:   User.PublicKey(),
 		})
 		if res == nil {
 			continue
 		}
-		tx := bc.NewTransaction(User, bc.Base64Decode(res.Data), splited[1], uint64(num))
+		balance, err := strconv.ParseUint(res.Data, 10, 64)
+		if err != nil {
+			continue
+		}
+		if balance <= uint64(fee) {
+			fmt.Printf("fail: (%s) balance <= fee\n", addr)
+			continue
+		}
+		nonce, version, err := fetchNonce(addr, User.PublicKey())
+		if err != nil {
+			continue
+		}
+		genesis, err := fetchGenesis(addr)
+		if err != nil {
+			continue
+		}
+		tx := bc.NewLegacyTransaction(User, genesis, version, nonce, []bc.Output{{
+			Receiver: User.Address(),
+			Value:    balance - uint64(fee),
+		}}, uint64(fee))
 		res = nt.Send(addr, &nt.Package{
 			Option: ADD_TRNSX,
-			Data:   bc.SerializeTX(tx),
+			Data:   bc.PackTX(tx),
 		})
 		if res == nil {
 			continue
 		}
 		if res.Data == "ok" {
 			fmt.Printf("ok: (%s)\n", addr)
-		} else {
-			fmt.Printf("fail: (%s)\n", addr)
+			break
 		}
+		fmt.Printf("fail: (%s)\n", addr)
 	}
 	fmt.Println()
 }
@@ -203,6 +555,10 @@ func chainBalance(splited []string) {
 		fmt.Println("fail: len(splited) != 2\n")
 		return
 	}
+	if !bc.AddressIsValid(splited[1]) {
+		fmt.Println("failed: address is not valid\n")
+		return
+	}
 	printBalance(splited[1])
 }
 
@@ -224,6 +580,10 @@ func userAddress() {
 	fmt.Println("Address:", User.Address(), "\n")
 }
 
+func userPublic() {
+	fmt.Println("Public:", User.PublicKey(), "\n")
+}
+
 func userPurse() {
 	fmt.Println("Purse:", User.Purse(), "\n")
 }
@@ -232,6 +592,205 @@ func userBalance() {
 	printBalance(User.Address())
 }
 
+func userHistory() {
+	res := nt.Send(Addresses[0], &nt.Package{
+		Option: GET_HSTRY,
+		Data:   User.Address(),
+	})
+	if res == nil || res.Data == "" {
+		fmt.Println("failed: getHistory\n")
+		return
+	}
+	fmt.Printf("History => %s\n\n", res.Data)
+}
+
+func multisigCreate(splited []string) {
+	if len(splited) < 3 {
+		fmt.Println("failed: len(splited) < 3\n")
+		return
+	}
+	num, err := strconv.Atoi(splited[1])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(num)\n")
+		return
+	}
+	ms := bc.NewMultisig(num, splited[2:])
+	if ms == nil {
+		fmt.Println("failed: multisig is not valid\n")
+		return
+	}
+	fmt.Println("Multisig:", ms.String())
+	fmt.Println("Address:", ms.Address(), "\n")
+}
+
+func multisigTX(splited []string) {
+	if len(splited) != 6 {
+		fmt.Println("failed: len(splited) != 6\n")
+		return
+	}
+	ms := bc.ParseMultisig(splited[1])
+	if ms == nil {
+		fmt.Println("failed: multisig is not valid\n")
+		return
+	}
+	if !bc.AddressIsValid(splited[2]) {
+		fmt.Println("failed: address is not valid\n")
+		return
+	}
+	num, err := strconv.Atoi(splited[3])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(num)\n")
+		return
+	}
+	fee, err := strconv.Atoi(splited[4])
+	if err != nil {
+		fmt.Println("failed: strconv.Atoi(fee)\n")
+		return
+	}
+	nonce, version, err := fetchNonce(Addresses[0], ms.Address())
+	if err != nil {
+		fmt.Println("failed: getNonce\n")
+		return
+	}
+	genesis, err := fetchGenesis(Addresses[0])
+	if err != nil {
+		fmt.Println("failed: getGenesis\n")
+		return
+	}
+	tx := bc.NewMultisigTransaction(ms, genesis, version, nonce, splited[2], uint64(num), uint64(fee))
+	err = tx.Cosign(User, genesis)
+	if err != nil {
+		fmt.Printf("failed: %s\n\n", err)
+		return
+	}
+	err = writeFile(splited[5], bc.SerializeTX(tx))
+	if err != nil {
+		fmt.Println("failed: write tx\n")
+		return
+	}
+	fmt.Println("TX:", bc.Base64Encode(tx.CurrHash), "\n")
+}
+
+func multisigSign(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	tx := bc.DeserializeTX(readFile(splited[1]))
+	if tx == nil {
+		fmt.Println("failed: read tx\n")
+		return
+	}
+	genesis, err := fetchGenesis(Addresses[0])
+	if err != nil {
+		fmt.Println("failed: getGenesis\n")
+		return
+	}
+	err = tx.Cosign(User, genesis)
+	if err != nil {
+		fmt.Printf("failed: %s\n\n", err)
+		return
+	}
+	err = writeFile(splited[1], bc.SerializeTX(tx))
+	if err != nil {
+		fmt.Println("failed: write tx\n")
+		return
+	}
+	fmt.Println("Signed:", tx.IsSigned(), "\n")
+}
+
+func multisigSend(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	tx := bc.DeserializeTX(readFile(splited[1]))
+	if tx == nil {
+		fmt.Println("failed: read tx\n")
+		return
+	}
+	if !tx.IsSigned() {
+		fmt.Println("failed: not enough signatures\n")
+		return
+	}
+	for _, addr := range Addresses {
+		res := nt.Send(addr, &nt.Package{
+			Option: ADD_TRNSX,
+			Data:   bc.PackTX(tx),
+		})
+		if res == nil {
+			continue
+		}
+		if res.Data == "ok" {
+			fmt.Printf("ok: (%s)\n", addr)
+			break
+		}
+		fmt.Printf("fail: (%s)\n", addr)
+	}
+	fmt.Println()
+}
+
+func walletList() {
+	for i, user := range Wallet.Users() {
+		mark := " "
+		if user.Address() == User.Address() {
+			mark = "*"
+		}
+		fmt.Printf("%s[%d] %s\n", mark, i, user.Address())
+	}
+	fmt.Println()
+}
+
+func walletDerive() {
+	user := Wallet.Derive()
+	if walletSave(WalletFile, Wallet) == nil {
+		Wallet.Size--
+		fmt.Println("failed: save wallet\n")
+		return
+	}
+	fmt.Printf("[%d] %s\n\n", Wallet.Size-1, user.Address())
+}
+
+func walletBalance() {
+	var total uint64
+	for i, user := range Wallet.Users() {
+		res := nt.Send(Addresses[0], &nt.Package{
+			Option: GET_BLNCE,
+			Data:   user.Address(),
+		})
+		if res == nil {
+			fmt.Println("failed: getBalance\n")
+			return
+		}
+		num, err := strconv.ParseUint(res.Data, 10, 64)
+		if err != nil {
+			fmt.Println("failed: strconv.ParseUint(balance)\n")
+			return
+		}
+		total += num
+		fmt.Printf("[%d] %s: %d coins\n", i, user.Address(), num)
+	}
+	fmt.Printf("Total: %d coins\n\n", total)
+}
+
+func walletUse(splited []string) {
+	if len(splited) != 2 {
+		fmt.Println("failed: len(splited) != 2\n")
+		return
+	}
+	num, err := strconv.Atoi(splited[1])
+	if err != nil || num < 0 || uint32(num) >= Wallet.Size {
+		fmt.Println("failed: account index is not valid\n")
+		return
+	}
+	User = Wallet.User(uint32(num))
+	fmt.Println("Address:", User.Address(), "\n")
+}
+
+func walletMnemonic() {
+	fmt.Println("Mnemonic:", Wallet.Mnemonic, "\n")
+}
+
 func inputString(begin string) string {
 	fmt.Print(begin)
 	msg, _ := bufio.NewReader(os.Stdin).ReadString('\n')
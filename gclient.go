@@ -1,21 +1,24 @@
 package main
 
 import (
-	"os"
-	"fmt"
-	nt "./network"
 	bc "./blockchain"
+	nt "./network"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
-	"html/template"
-	"encoding/json"
 )
 
 const (
 	STTC_PATH = "static/"
 	TMPL_PATH = "templates/"
 	ADDR_FILE = "addr.json"
+	KEYS_SIZE = (64 << 10) // (2^10)*64 = 64KiB
 )
 
 func init() {
@@ -66,7 +69,7 @@ func indexPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
+	var data struct {
 		User *bc.User
 	}
 	data.User = User
@@ -81,8 +84,8 @@ func accountPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
-		User *bc.User
+	var data struct {
+		User    *bc.User
 		Address string
 		Balance string
 	}
@@ -111,15 +114,15 @@ func loginPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
-		User *bc.User
+	var data struct {
+		User  *bc.User
 		Error string
 	}
 	if r.Method == "POST" {
-		r.ParseForm()
-		User = bc.LoadUser(r.FormValue("private"))
+		r.ParseMultipartForm(KEYS_SIZE)
+		User = loadKeystore(r)
 		if User == nil {
-			data.Error = "Load Private Key Error"
+			data.Error = "Load Keystore Error"
 		} else {
 			http.Redirect(w, r, "/", 302)
 			return
@@ -129,6 +132,19 @@ func loginPage(w http.ResponseWriter, r *http.Request) {
 	t.Execute(w, data)
 }
 
+func loadKeystore(r *http.Request) *bc.User {
+	file, _, err := r.FormFile("keystore")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	keystore, err := ioutil.ReadAll(io.LimitReader(file, KEYS_SIZE))
+	if err != nil {
+		return nil
+	}
+	return bc.DecryptUser(string(keystore), r.FormValue("password"))
+}
+
 func logoutPage(w http.ResponseWriter, r *http.Request) {
 	User = nil
 	http.Redirect(w, r, "/", 302)
@@ -142,13 +158,17 @@ func signupPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
-		User *bc.User
-		PrivateKey string
+	var data struct {
+		User     *bc.User
+		Keystore string
 	}
 	data.User = User
 	if r.Method == "POST" {
-		data.PrivateKey = bc.NewUser().Purse()
+		r.ParseForm()
+		user := bc.NewUserScheme(r.FormValue("scheme"))
+		if user != nil && r.FormValue("password") != "" {
+			data.Keystore = bc.EncryptUser(user, r.FormValue("password"))
+		}
 	}
 	t.Execute(w, data)
 }
@@ -161,8 +181,8 @@ func transactionPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
-		User *bc.User
+	var data struct {
+		User  *bc.User
 		Error string
 	}
 	data.User = User
@@ -172,31 +192,54 @@ func transactionPage(w http.ResponseWriter, r *http.Request) {
 			data.Error = "User not authorizated"
 			t.Execute(w, data)
 			return
-		} 
+		}
 		receiver := r.FormValue("receiver")
+		if !bc.AddressIsValid(receiver) {
+			data.Error = "Receiver address is not valid"
+			t.Execute(w, data)
+			return
+		}
 		num, err := strconv.Atoi(r.FormValue("value"))
 		if err != nil {
 			data.Error = "strconv.Atoi error"
 			t.Execute(w, data)
 			return
 		}
-		flag := false 
+		fee, err := strconv.Atoi(r.FormValue("fee"))
+		if err != nil {
+			data.Error = "strconv.Atoi error"
+			t.Execute(w, data)
+			return
+		}
+		lock := 0
+		if r.FormValue("lock") != "" {
+			lock, err = strconv.Atoi(r.FormValue("lock"))
+			if err != nil {
+				data.Error = "strconv.Atoi error"
+				t.Execute(w, data)
+				return
+			}
+		}
+		flag := false
 		for _, addr := range Addresses {
-			res := nt.Send(addr, &nt.Package{
-				Option: GET_LHASH,
-			})
-			if res == nil {
+			nonce, version, err := fetchNonce(addr, User.Address())
+			if err != nil {
 				continue
 			}
-			tx := bc.NewTransaction(User, bc.Base64Decode(res.Data), receiver, uint64(num))
-			res = nt.Send(addr, &nt.Package{
+			genesis, err := fetchGenesis(addr)
+			if err != nil {
+				continue
+			}
+			tx := bc.NewLockedTransaction(User, genesis, version, nonce, receiver, uint64(num), uint64(fee), uint64(lock))
+			res := nt.Send(addr, &nt.Package{
 				Option: ADD_TRNSX,
-				Data:   bc.SerializeTX(tx),
+				Data:   bc.PackTX(tx),
 			})
 			if res == nil || res.Data != "ok" {
 				continue
 			}
 			flag = true
+			break
 		}
 		if !flag {
 			data.Error = "TX failed"
@@ -215,19 +258,19 @@ func blockchainPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
-		Error string
-		Size []bool
+	var data struct {
+		Error   string
+		Size    []bool
 		Address string
-		Balance string 
-		User *bc.User
+		Balance string
+		User    *bc.User
 	}
 	data.User = User
 	if r.Method == "POST" {
 		data.Address = r.FormValue("address")
 		res := nt.Send(Addresses[0], &nt.Package{
 			Option: GET_BLNCE,
-			Data: data.Address,
+			Data:   data.Address,
 		})
 		if res != nil {
 			data.Balance = res.Data
@@ -239,13 +282,13 @@ func blockchainPage(w http.ResponseWriter, r *http.Request) {
 	if res == nil || res.Data == "" {
 		data.Error = "Receive error"
 		t.Execute(w, data)
-		return 
+		return
 	}
 	num, err := strconv.Atoi(res.Data)
 	if err != nil {
 		data.Error = "strconv.Atoi error"
 		t.Execute(w, data)
-		return 
+		return
 	}
 	data.Size = make([]bool, num)
 	t.Execute(w, data)
@@ -259,26 +302,26 @@ func blockchainXPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic("can't load hmtl files")
 	}
-	var data struct{
+	var data struct {
 		Error string
 		Block *bc.Block
-		User *bc.User
+		User  *bc.User
 	}
 	data.User = User
 	res := nt.Send(Addresses[0], &nt.Package{
 		Option: GET_BLOCK,
-		Data: strings.Replace(r.URL.Path, "/blockchain/", "", 1),
+		Data:   strings.Replace(r.URL.Path, "/blockchain/", "", 1),
 	})
 	if res == nil || res.Data == "" {
 		data.Error = "Receive error"
 		t.Execute(w, data)
-		return 
+		return
 	}
-	data.Block = bc.DeserializeBlock(res.Data)
+	data.Block = bc.UnpackBlock(res.Data)
 	if data.Block == nil {
 		data.Error = "Block is nil"
 		t.Execute(w, data)
-		return 
+		return
 	}
 	t.Execute(w, data)
 }
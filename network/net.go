@@ -1,9 +1,10 @@
 package network
 
 import (
+	"bytes"
 	"net"
-	"time"
 	"strings"
+	"time"
 )
 
 type Listener net.Listener
@@ -50,16 +51,16 @@ func Send(address string, pack *Package) *Package {
 	defer conn.Close()
 	conn.Write([]byte(SerializePackage(pack) + ENDBYTES))
 	var res = new(Package)
- 	ch := make(chan bool)
+	ch := make(chan bool)
 	go func() {
 		res = readPackage(conn)
 		ch <- true
 	}()
- 	select {
-  		case <-ch:
-  		case <-time.After(WAITTIME * time.Second):
- 	}
- 	return res
+	select {
+	case <-ch:
+	case <-time.After(WAITTIME * time.Second):
+	}
+	return res
 }
 
 func Handle(option int, conn Conn, pack *Package, handle func(*Package) string) bool {
@@ -75,8 +76,7 @@ func Handle(option int, conn Conn, pack *Package, handle func(*Package) string)
 
 func readPackage(conn net.Conn) *Package {
 	var (
-		data   string
-		size   = uint64(0)
+		data   []byte
 		buffer = make([]byte, BUFFSIZE)
 	)
 	for {
@@ -84,15 +84,18 @@ func readPackage(conn net.Conn) *Package {
 		if err != nil {
 			return nil
 		}
-		size += uint64(length)
-		if size > DMAXSIZE {
+		if uint64(len(data)+length) > DMAXSIZE {
 			return nil
 		}
-		data += string(buffer[:length])
-		if strings.Contains(data, ENDBYTES) {
-			data = strings.Split(data, ENDBYTES)[0]
+		from := len(data) - len(ENDBYTES)
+		if from < 0 {
+			from = 0
+		}
+		data = append(data, buffer[:length]...)
+		if index := bytes.Index(data[from:], []byte(ENDBYTES)); index >= 0 {
+			data = data[:from+index]
 			break
 		}
 	}
-	return DeserializePackage(data)
+	return DeserializePackage(string(data))
 }
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -14,20 +16,32 @@ func init() {
 		panic("failed: len(os.Args) < 2")
 	}
 	var (
-		serveStr     = ""
-		addrStr      = ""
-		userNewStr   = ""
-		userLoadStr  = ""
-		chainNewStr  = ""
-		chainLoadStr = ""
+		serveStr       = ""
+		addrStr        = ""
+		userNewStr     = ""
+		userLoadStr    = ""
+		userMigrateStr = ""
+		chainNewStr    = ""
+		chainLoadStr   = ""
+		rebuildStr     = ""
+		migrateStr     = ""
+		intervalStr    = ""
+		emptyStr       = ""
+		storeStr       = bc.DEFAULT_STORE
+		schemeStr      = bc.DEFAULT_SCHEME
 	)
 	var (
-		serveExist     = false
-		addrExist      = false
-		userNewExist   = false
-		userLoadExist  = false
-		chainNewExist  = false
-		chainLoadExist = false
+		serveExist       = false
+		addrExist        = false
+		userNewExist     = false
+		userLoadExist    = false
+		userMigrateExist = false
+		chainNewExist    = false
+		chainLoadExist   = false
+		rebuildExist     = false
+		migrateExist     = false
+		intervalExist    = false
+		emptyExist       = false
 	)
 	for i := 1; i < len(os.Args); i++ {
 		arg := os.Args[i]
@@ -44,23 +58,57 @@ func init() {
 		case strings.HasPrefix(arg, "-loaduser:"):
 			userLoadStr = strings.Replace(arg, "-loaduser:", "", 1)
 			userLoadExist = true
+		case strings.HasPrefix(arg, "-migrateuser:"):
+			userMigrateStr = strings.Replace(arg, "-migrateuser:", "", 1)
+			userMigrateExist = true
 		case strings.HasPrefix(arg, "-newchain:"):
 			chainNewStr = strings.Replace(arg, "-newchain:", "", 1)
 			chainNewExist = true
 		case strings.HasPrefix(arg, "-loadchain:"):
 			chainLoadStr = strings.Replace(arg, "-loadchain:", "", 1)
 			chainLoadExist = true
+		case strings.HasPrefix(arg, "-rebuildchain:"):
+			rebuildStr = strings.Replace(arg, "-rebuildchain:", "", 1)
+			rebuildExist = true
+		case strings.HasPrefix(arg, "-migratechain:"):
+			migrateStr = strings.Replace(arg, "-migratechain:", "", 1)
+			migrateExist = true
+		case strings.HasPrefix(arg, "-interval:"):
+			intervalStr = strings.Replace(arg, "-interval:", "", 1)
+			intervalExist = true
+		case strings.HasPrefix(arg, "-emptyblocks:"):
+			emptyStr = strings.Replace(arg, "-emptyblocks:", "", 1)
+			emptyExist = true
+		case strings.HasPrefix(arg, "-store:"):
+			storeStr = strings.Replace(arg, "-store:", "", 1)
+		case strings.HasPrefix(arg, "-scheme:"):
+			schemeStr = strings.Replace(arg, "-scheme:", "", 1)
 		}
 	}
 
-	if 	!(userNewExist || userLoadExist) || !(chainNewExist || chainLoadExist) || 
-		!serveExist || !addrExist {
-			panic("failed: !(userNewExist || userLoadExist)"+
-				"|| !(chainNewExist || chainLoadExist) || !serveExist || !addrExist")
+	if !(userNewExist || userLoadExist || userMigrateExist) ||
+		!(chainNewExist || chainLoadExist || rebuildExist || migrateExist) || !serveExist || !addrExist {
+		panic("failed: !(userNewExist || userLoadExist || userMigrateExist)" +
+			"|| !(chainNewExist || chainLoadExist || rebuildExist || migrateExist) || !serveExist || !addrExist")
 	}
 
 	Serve = serveStr
 
+	if intervalExist {
+		interval, err := strconv.Atoi(intervalStr)
+		if err != nil || interval <= 0 {
+			panic("failed: parse interval")
+		}
+		MineInterval = time.Duration(interval) * time.Second
+	}
+	if emptyExist {
+		empty, err := strconv.ParseBool(emptyStr)
+		if err != nil {
+			panic("failed: parse emptyblocks")
+		}
+		MineEmpty = empty
+	}
+
 	var addresses []string
 	err := json.Unmarshal([]byte(readFile(addrStr)), &addresses)
 	if err != nil {
@@ -80,49 +128,93 @@ func init() {
 	}
 
 	if userNewExist {
-		User = userNew(userNewStr)
+		User = userNew(userNewStr, schemeStr)
 	}
 	if userLoadExist {
 		User = userLoad(userLoadStr)
 	}
+	if userMigrateExist {
+		User = userMigrate(userMigrateStr)
+	}
 	if User == nil {
 		panic("failed: load user")
 	}
 
 	if chainNewExist {
 		Filename = chainNewStr
-		Chain = chainNew(chainNewStr)
+		Chain = chainNew(storeStr, chainNewStr)
 	}
 	if chainLoadExist {
 		Filename = chainLoadStr
-		Chain = chainLoad(chainLoadStr)
+		Chain = chainLoad(storeStr, chainLoadStr)
+	}
+	if rebuildExist {
+		Filename = rebuildStr
+		Chain = chainRebuild(storeStr, rebuildStr)
+	}
+	if migrateExist {
+		Filename = migrateStr
+		Chain = chainMigrate(storeStr, migrateStr)
 	}
 	if Chain == nil {
 		panic("failed: load chain")
 	}
 
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
+	Pool = bc.LoadMempool(Chain)
+	if Pool == nil {
+		panic("failed: load mempool")
+	}
 }
 
 func main() {
 	nt.Listen(Serve, handleServer)
+	go mineLoop()
 	for {
 		fmt.Scanln()
 	}
 }
 
-func chainNew(filename string) *bc.BlockChain {
-	err := bc.NewChain(filename, User.Address())
+func chainNew(backend, filename string) *bc.BlockChain {
+	chain, err := bc.NewChain(backend, filename, User.Address())
 	if err != nil {
 		return nil
 	}
-	return bc.LoadChain(filename)
+	return chain
+}
+
+func chainLoad(backend, filename string) *bc.BlockChain {
+	chain := bc.LoadChain(backend, filename)
+	if chain == nil {
+		return nil
+	}
+	return chain
 }
 
-func chainLoad(filename string) *bc.BlockChain {
-	chain := bc.LoadChain(filename)
+func chainRebuild(backend, filename string) *bc.BlockChain {
+	chain := bc.LoadChain(backend, filename)
 	if chain == nil {
 		return nil
 	}
+	err := chain.Rebuild()
+	if err != nil {
+		return nil
+	}
+	return chain
+}
+
+func chainMigrate(backend, filename string) *bc.BlockChain {
+	chain := bc.LoadChain(backend, filename)
+	if chain == nil {
+		return nil
+	}
+	err := chain.Store.Migrate()
+	if err != nil {
+		fmt.Println("failed:", err)
+		return nil
+	}
+	err = chain.Rebuild()
+	if err != nil {
+		return nil
+	}
 	return chain
 }
@@ -3,30 +3,33 @@ package main
 import (
 	bc "./blockchain"
 	nt "./network"
-	"bytes"
-	"database/sql"
-	"encoding/hex"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
-	"io"
-	"os"
+	"math/big"
 	"strconv"
 	"strings"
 	"sync"
-	"sort"
+	"time"
 )
 
 var (
-	Filename    string
-	Serve       string
-	Chain       *bc.BlockChain
-	Block       *bc.Block
-	Mutex       sync.Mutex
+	Filename string
+	Serve    string
+	Chain    *bc.BlockChain
+	Pool     *bc.Mempool
+	Mutex    sync.Mutex
+	Syncing  bool
+)
+
+const (
+	MINE_INTERVAL = 10 // seconds
+	DATA_LIMIT    = nt.DMAXSIZE - nt.BUFFSIZE
 )
 
 var (
-	IsMining    bool
-	BreakMining = make(chan bool)
+	IsMining     bool
+	BreakMining  = make(chan bool, 1)
+	MineInterval = MINE_INTERVAL * time.Second
+	MineEmpty    bool
 )
 
 func handleServer(conn nt.Conn, pack *nt.Package) {
@@ -36,6 +39,13 @@ func handleServer(conn nt.Conn, pack *nt.Package) {
 	nt.Handle(GET_LHASH, conn, pack, getLastHash)
 	nt.Handle(GET_BLNCE, conn, pack, getBalance)
 	nt.Handle(GET_CSIZE, conn, pack, getChainSize)
+	nt.Handle(GET_PROOF, conn, pack, getProof)
+	nt.Handle(GET_TRNSX, conn, pack, getTransaction)
+	nt.Handle(GET_HSTRY, conn, pack, getHistory)
+	nt.Handle(GET_NONCE, conn, pack, getNonce)
+	nt.Handle(GET_SUPLY, conn, pack, getSupply)
+	nt.Handle(GET_HEADERS, conn, pack, getHeaders)
+	nt.Handle(GET_BLOCKS, conn, pack, getBlocks)
 }
 
 func getChainSize(pack *nt.Package) string {
@@ -44,245 +54,301 @@ func getChainSize(pack *nt.Package) string {
 
 func addBlock(pack *nt.Package) string {
 	splited := strings.Split(pack.Data, SEPARATOR)
-	if len(splited) != 3 {
+	if len(splited) != 4 {
 		return "fail"
 	}
 
-	block := bc.DeserializeBlock(splited[2])
-	if !block.IsValid(Chain, Chain.Size()) {
-		currSize := Chain.Size()
-		num, err := strconv.Atoi(splited[1])
-		if err != nil {
-			return "fail"
-		}
-		if currSize < uint64(num) {
-			go compareChains(splited[0], uint64(num))
-			return "ok"
-		}
+	block := bc.UnpackBlock(splited[3])
+	if block == nil {
 		return "fail"
 	}
 
 	Mutex.Lock()
 
-	Chain.AddBlock(block)
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
+	valid := block.IsValid(Chain, Chain.Size()) && Chain.AddBlock(block) == nil
+	if valid {
+		Pool.Revalidate(Chain)
+		breakMining()
+	}
 
 	Mutex.Unlock()
 
-	if IsMining {
-		BreakMining <- true
-		IsMining = false
+	if !valid {
+		num, err := strconv.Atoi(splited[1])
+		if err != nil {
+			return "fail"
+		}
+		work, ok := new(big.Int).SetString(splited[2], 10)
+		if !ok {
+			return "fail"
+		}
+		if work.Cmp(Chain.Work()) > 0 {
+			go compareChains(splited[0], uint64(num))
+			return "ok"
+		}
+		return "fail"
 	}
-
 	return "ok"
 }
 
 func compareChains(address string, num uint64) {
-	filename := "temp_" + hex.EncodeToString(bc.GenerateRandomBytes(8))
-	file, err := os.Create(filename)
-	if err != nil {
+	Mutex.Lock()
+	if Syncing {
+		Mutex.Unlock()
 		return
 	}
-	file.Close()
+	Syncing = true
+	Mutex.Unlock()
+
 	defer func() {
-		os.Remove(filename)
+		Mutex.Lock()
+		Syncing = false
+		Mutex.Unlock()
 	}()
 
-	res := nt.Send(address, &nt.Package{
-		Option: GET_BLOCK,
-		Data:   fmt.Sprintf("%d", 0),
+	height, headers, err := Chain.FindHeaders(num, func(start, count uint64) []*bc.BlockHeader {
+		headers, err := fetchHeaders(address, start, count)
+		if err != nil {
+			return nil
+		}
+		return headers
 	})
-	if res == nil {
+	if err != nil {
 		return
 	}
 
-	genesis := bc.DeserializeBlock(res.Data)
-	if genesis == nil {
-		return
+	var peers = []string{address}
+	for _, addr := range Addresses {
+		if addr != address {
+			peers = append(peers, addr)
+		}
 	}
-
-	if !bytes.Equal(genesis.CurrHash, hashBlock(genesis)) {
+	blocks, err := bc.FetchBodies(height, headers, len(peers), func(peer int, start, count uint64) []*bc.Block {
+		blocks, _ := fetchBlocks(peers[peer], start, count)
+		return blocks
+	})
+	if err != nil {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", filename)
+	Mutex.Lock()
+	defer Mutex.Unlock()
+
+	orphans, err := Chain.Reorganize(&bc.Fork{
+		Height: height,
+		Blocks: blocks,
+	})
 	if err != nil {
 		return
 	}
-	defer db.Close()
-
-	_, err = db.Exec(bc.CREATE_TABLE)
-	chain := &bc.BlockChain{
-		DB: db,
-	}
-	chain.AddBlock(genesis)
-
-	defer func() {
-		chain.DB.Close()
-	}()
-
-	for i := uint64(1); i < num; i++ {
-		res := nt.Send(address, &nt.Package{
-			Option: GET_BLOCK,
-			Data:   fmt.Sprintf("%d", i),
-		})
-		if res == nil {
-			return
-		}
-		block := bc.DeserializeBlock(res.Data)
-		if block == nil {
-			return
-		}
-		if !block.IsValid(chain, i) {
-			return
+	for _, block := range orphans {
+		for i := range block.Transactions {
+			Pool.Add(Chain, &block.Transactions[i])
 		}
-		chain.AddBlock(block)
 	}
+	Pool.Revalidate(Chain)
+	breakMining()
+}
 
-	Mutex.Lock()
-
-	Chain.DB.Close()
-	os.Remove(Filename)
-
-	copyFile(filename, Filename)
-	Chain = bc.LoadChain(Filename)
-	Block = bc.NewBlock(User.Address(), Chain.LastHash())
-
-	Mutex.Unlock()
-
-	if IsMining {
-		BreakMining <- true
-		IsMining = false
+func getBlock(pack *nt.Package) string {
+	num, err := strconv.Atoi(pack.Data)
+	if err != nil {
+		return ""
+	}
+	size := Chain.Size()
+	if num < 0 || uint64(num) >= size {
+		return ""
+	}
+	block := Chain.Block(uint64(num) + 1)
+	if block == nil {
+		return ""
 	}
+	return bc.PackBlock(block)
+}
 
-	return
+func getHeaders(pack *nt.Package) string {
+	return selectRange(pack, bc.HEADERS_LIMIT, func(id uint64) string {
+		header := Chain.Header(id)
+		if header == nil {
+			return ""
+		}
+		return bc.PackHeader(header)
+	})
 }
 
-func hashBlock(block *bc.Block) []byte {
-	var tempHash []byte
-	for _, tx := range block.Transactions {
-		tempHash = bc.HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				tx.CurrHash,
-			},
-			[]byte{},
-		))
-	}
-	var list []string
-	for hash := range block.Mapping {
-		list = append(list, hash)
-	}
-	sort.Strings(list)
-	for _, hash := range list {
-		tempHash = bc.HashSum(bytes.Join(
-			[][]byte{
-				tempHash,
-				[]byte(hash),
-				bc.ToBytes(block.Mapping[hash]),
-			},
-			[]byte{},
-		))
-	}
-	return bc.HashSum(bytes.Join(
-		[][]byte{
-			tempHash,
-			bc.ToBytes(uint64(block.Difficulty)),
-			block.PrevHash,
-			[]byte(block.Miner),
-			[]byte(block.TimeStamp),
-		},
-		[]byte{},
-	))
+func getBlocks(pack *nt.Package) string {
+	return selectRange(pack, bc.BLOCKS_LIMIT, func(id uint64) string {
+		block := Chain.Block(id)
+		if block == nil {
+			return ""
+		}
+		return bc.PackBlock(block)
+	})
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
+func selectRange(pack *nt.Package, limit uint64, encode func(id uint64) string) string {
+	splited := strings.Split(pack.Data, SEPARATOR)
+	if len(splited) != 2 {
+		return ""
 	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
+	start, err := strconv.ParseUint(splited[0], 10, 64)
 	if err != nil {
-		return err
+		return ""
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
+	count, err := strconv.ParseUint(splited[1], 10, 64)
 	if err != nil {
-		return err
+		return ""
 	}
-	return out.Close()
+	if count > limit {
+		count = limit
+	}
+	var (
+		size   = Chain.Size()
+		items  []string
+		length = 0
+	)
+	for id := start + 1; id <= start+count && id <= size; id++ {
+		item := encode(id)
+		if item == "" {
+			break
+		}
+		length += len(item) + len(SEPARATOR)
+		if length > DATA_LIMIT {
+			break
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, SEPARATOR)
 }
 
-func getBlock(pack *nt.Package) string {
-	num, err := strconv.Atoi(pack.Data)
-	if err != nil {
+func getLastHash(pack *nt.Package) string {
+	return bc.Base64Encode(Chain.LastHash())
+}
+
+func getProof(pack *nt.Package) string {
+	proof := Chain.Proof(bc.Base64Decode(pack.Data))
+	if proof == nil {
 		return ""
 	}
-	size := Chain.Size()
-	if uint64(num) < size {
-		return selectBlock(Chain, num)
+	return bc.SerializeProof(proof)
+}
+
+func getTransaction(pack *nt.Package) string {
+	info := Chain.TxInfo(bc.Base64Decode(pack.Data))
+	if info == nil {
+		return ""
 	}
-	return ""
+	return bc.SerializeTxInfo(info)
 }
 
-func getLastHash(pack *nt.Package) string {
-	return bc.Base64Encode(Chain.LastHash())
+func getHistory(pack *nt.Package) string {
+	return bc.SerializeHistory(Chain.History(pack.Data))
 }
 
-func getBalance(pack *nt.Package) string {
-	return fmt.Sprintf("%d", Chain.Balance(pack.Data, Chain.Size()))
+func getNonce(pack *nt.Package) string {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	return fmt.Sprintf("%d", Pool.Nonce(Chain, pack.Data)) + SEPARATOR +
+		fmt.Sprintf("%d", Chain.Version(Chain.Size()+1))
+}
+
+func getSupply(pack *nt.Package) string {
+	size := Chain.Size()
+	if pack.Data != "" {
+		num, err := strconv.Atoi(pack.Data)
+		if err != nil || num < 0 || uint64(num) > size {
+			return ""
+		}
+		size = uint64(num)
+	}
+	return fmt.Sprintf("%d", Chain.Supply(size))
 }
 
-func selectBlock(chain *bc.BlockChain, i int) string {
-	var block string
-	row := chain.DB.QueryRow("SELECT Block FROM BlockChain WHERE Id=$1", i+1)
-	row.Scan(&block)
-	return block
+func getBalance(pack *nt.Package) string {
+	return fmt.Sprintf("%d", Chain.Balance(pack.Data, Chain.Size()))
 }
 
 func addTransaction(pack *nt.Package) string {
-	var tx = bc.DeserializeTX(pack.Data)
-	if tx == nil || len(Block.Transactions) == bc.TXS_LIMIT {
+	var tx = bc.UnpackTX(pack.Data)
+	if tx == nil {
 		return "fail"
 	}
 	Mutex.Lock()
-	err := Block.AddTransaction(Chain, tx)
+	err := Pool.Add(Chain, tx)
 	Mutex.Unlock()
 	if err != nil {
 		return "fail"
 	}
-	if len(Block.Transactions) == bc.TXS_LIMIT {
-		go func() {
-			Mutex.Lock()
-			block := *Block
-			IsMining = true
-			Mutex.Unlock()
-			res := (&block).Accept(Chain, User, BreakMining)
-			Mutex.Lock()
-			IsMining = false
-			if res == nil && bytes.Equal(block.PrevHash, Block.PrevHash) {
-				Chain.AddBlock(&block)
-				pushBlockToNet(&block)
-			}
-			Block = bc.NewBlock(User.Address(), Chain.LastHash())
-			Mutex.Unlock()
-		}()
-	}
+	pushTXToNet(tx)
 	return "ok"
 }
 
+func mineLoop() {
+	for range time.Tick(MineInterval) {
+		mineBlock()
+	}
+}
+
+func mineBlock() {
+	Mutex.Lock()
+	if IsMining || Syncing {
+		Mutex.Unlock()
+		return
+	}
+	block := bc.NewBlock(User.Address(), Chain.LastHash(), Chain.Difficulty(Chain.Size()))
+	Pool.Fill(Chain, block)
+	if len(block.Transactions) == 0 && !MineEmpty {
+		Mutex.Unlock()
+		return
+	}
+	select {
+	case <-BreakMining:
+	default:
+	}
+	IsMining = true
+	Mutex.Unlock()
+	res := block.Accept(Chain, User, BreakMining)
+	Mutex.Lock()
+	IsMining = false
+	if res != nil || !block.IsValid(Chain, Chain.Size()) || Chain.AddBlock(block) != nil {
+		Mutex.Unlock()
+		return
+	}
+	Pool.Revalidate(Chain)
+	pushBlockToNet(block)
+	Mutex.Unlock()
+}
+
+func breakMining() {
+	if !IsMining {
+		return
+	}
+	select {
+	case BreakMining <- true:
+	default:
+	}
+}
+
 func pushBlockToNet(block *bc.Block) {
 	var (
-		sblock = bc.SerializeBlock(block)
-		msg = Serve + SEPARATOR + fmt.Sprintf("%d", Chain.Size()) + SEPARATOR + sblock
+		sblock = bc.PackBlock(block)
+		msg    = Serve + SEPARATOR + fmt.Sprintf("%d", Chain.Size()) + SEPARATOR +
+			Chain.Work().String() + SEPARATOR + sblock
 	)
 	for _, addr := range Addresses {
 		go nt.Send(addr, &nt.Package{
 			Option: ADD_BLOCK,
-			Data: msg,
+			Data:   msg,
+		})
+	}
+}
+
+func pushTXToNet(tx *bc.Transaction) {
+	var stx = bc.PackTX(tx)
+	for _, addr := range Addresses {
+		go nt.Send(addr, &nt.Package{
+			Option: ADD_TRNSX,
+			Data:   stx,
 		})
 	}
 }
@@ -2,12 +2,21 @@ package main
 
 import (
 	bc "./blockchain"
+	nt "./network"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
 	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
 )
 
 var (
-	Addresses []string
-	User      *bc.User
+	Addresses  []string
+	User       *bc.User
+	Wallet     *bc.Wallet
+	WalletFile string
 )
 
 const (
@@ -16,26 +25,48 @@ const (
 
 const (
 	ADD_BLOCK = iota + 1
-	ADD_TRNSX 
-	GET_BLOCK       
-	GET_LHASH    
-	GET_BLNCE   
+	ADD_TRNSX
+	GET_BLOCK
+	GET_LHASH
+	GET_BLNCE
 	GET_CSIZE
+	GET_PROOF
+	GET_TRNSX
+	GET_HSTRY
+	GET_NONCE
+	GET_SUPLY
+	GET_HEADERS
+	GET_BLOCKS
 )
 
-func userNew(filename string) *bc.User {
-	user := bc.NewUser()
+func userNew(filename, scheme string) *bc.User {
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		return nil
+	}
+	user := bc.NewUserScheme(scheme)
 	if user == nil {
 		return nil
 	}
-	err := writeFile(filename, user.Purse())
+	return userSave(filename, user)
+}
+
+func userLoad(filename string) *bc.User {
+	keystore := readFile(filename)
+	if keystore == "" {
+		return nil
+	}
+	pass, err := readPassword("Passphrase: ")
 	if err != nil {
 		return nil
 	}
+	user := bc.DecryptUser(keystore, pass)
+	if user == nil {
+		return nil
+	}
 	return user
 }
 
-func userLoad(filename string) *bc.User {
+func userMigrate(filename string) *bc.User {
 	priv := readFile(filename)
 	if priv == "" {
 		return nil
@@ -44,9 +75,191 @@ func userLoad(filename string) *bc.User {
 	if user == nil {
 		return nil
 	}
+	return userSave(filename, user)
+}
+
+func userSave(filename string, user *bc.User) *bc.User {
+	pass, err := readPassword("New passphrase: ")
+	if err != nil || pass == "" {
+		return nil
+	}
+	repeat, err := readPassword("Repeat passphrase: ")
+	if err != nil || pass != repeat {
+		return nil
+	}
+	keystore := bc.EncryptUser(user, pass)
+	if keystore == "" {
+		return nil
+	}
+	err = writeKeyFile(filename, keystore)
+	if err != nil {
+		return nil
+	}
 	return user
 }
 
+func walletNew(filename string) *bc.Wallet {
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		return nil
+	}
+	wallet := bc.NewWallet()
+	if wallet == nil {
+		return nil
+	}
+	return walletSave(filename, wallet)
+}
+
+func walletLoad(filename string) *bc.Wallet {
+	keystore := readFile(filename)
+	if keystore == "" {
+		return nil
+	}
+	pass, err := readPassword("Passphrase: ")
+	if err != nil {
+		return nil
+	}
+	wallet := bc.DecryptWallet(keystore, pass)
+	if wallet == nil {
+		return nil
+	}
+	return wallet
+}
+
+func walletSave(filename string, wallet *bc.Wallet) *bc.Wallet {
+	pass, err := readPassword("Passphrase: ")
+	if err != nil || pass == "" {
+		return nil
+	}
+	if old := readFile(filename); old != "" {
+		if bc.DecryptWallet(old, pass) == nil {
+			return nil
+		}
+	} else {
+		repeat, err := readPassword("Repeat passphrase: ")
+		if err != nil || pass != repeat {
+			return nil
+		}
+	}
+	keystore := bc.EncryptWallet(wallet, pass)
+	if keystore == "" {
+		return nil
+	}
+	err = writeKeyFile(filename, keystore)
+	if err != nil {
+		return nil
+	}
+	return wallet
+}
+
+func fetchNonce(addr, address string) (uint64, uint8, error) {
+	res := nt.Send(addr, &nt.Package{
+		Option: GET_NONCE,
+		Data:   address,
+	})
+	if res == nil {
+		return 0, 0, errors.New("get nonce")
+	}
+	splited := strings.Split(res.Data, SEPARATOR)
+	if len(splited) != 2 {
+		return 0, 0, errors.New("len(splited) != 2")
+	}
+	nonce, err := strconv.ParseUint(splited[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	version, err := strconv.ParseUint(splited[1], 10, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return nonce, uint8(version), nil
+}
+
+func fetchGenesis(addr string) ([]byte, error) {
+	headers, err := fetchHeaders(addr, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) != 1 {
+		return nil, errors.New("get genesis")
+	}
+	return headers[0].CurrHash, nil
+}
+
+func fetchBlocks(addr string, start, count uint64) ([]*bc.Block, error) {
+	var blocks []*bc.Block
+	err := fetchRange(addr, GET_BLOCKS, start, count, func(data string) error {
+		block := bc.UnpackBlock(data)
+		if block == nil {
+			return errors.New("unpack block")
+		}
+		blocks = append(blocks, block)
+		return nil
+	})
+	return blocks, err
+}
+
+func fetchHeaders(addr string, start, count uint64) ([]*bc.BlockHeader, error) {
+	var headers []*bc.BlockHeader
+	err := fetchRange(addr, GET_HEADERS, start, count, func(data string) error {
+		header := bc.UnpackHeader(data)
+		if header == nil {
+			return errors.New("unpack header")
+		}
+		headers = append(headers, header)
+		return nil
+	})
+	return headers, err
+}
+
+func fetchRange(addr string, option int, start, count uint64, unpack func(data string) error) error {
+	for fetched := uint64(0); fetched < count; {
+		res := nt.Send(addr, &nt.Package{
+			Option: option,
+			Data:   fmt.Sprintf("%d", start+fetched) + SEPARATOR + fmt.Sprintf("%d", count-fetched),
+		})
+		if res == nil {
+			return errors.New("fetch range")
+		}
+		if res.Data == "" {
+			return nil
+		}
+		for _, item := range strings.Split(res.Data, SEPARATOR) {
+			if fetched == count {
+				break
+			}
+			err := unpack(item)
+			if err != nil {
+				return err
+			}
+			fetched++
+		}
+	}
+	return nil
+}
+
+func readPassword(begin string) (string, error) {
+	fmt.Print(begin)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return string(pass), nil
+}
+
+func writeKeyFile(filename string, data string) error {
+	temp := filename + ".tmp"
+	err := os.Remove(temp)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = ioutil.WriteFile(temp, []byte(data), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, filename)
+}
+
 func writeFile(filename string, data string) error {
 	return ioutil.WriteFile(filename, []byte(data), 0644)
 }